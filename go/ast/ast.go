@@ -2,15 +2,20 @@ package ast
 
 import (
 	"strings"
+
+	"alde.nu/mint/token"
 )
 
 type Node interface {
 	TokenLiteral() string
+	// Pos is the position of the node's token in the source.
+	Pos() token.Position
 	String() string
 }
 
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // in source order, they aren't part of the tree
 }
 
 func (p *Program) String() string {
@@ -27,3 +32,20 @@ func (p *Program) TokenLiteral() string {
 	}
 	return ""
 }
+
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+// Comment is a // line comment. The parser collects them in
+// Program.Comments for tools like the formatter, nothing else sees them.
+type Comment struct {
+	Token token.Token // the token.COMMENT token, Literal is the full text
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos }
+func (c *Comment) String() string       { return c.Token.Literal }
@@ -0,0 +1,219 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// nodeKinds maps the "kind" of an encoded node to its type. Every node
+// type has to be listed here to be decoded.
+var nodeKinds = kindsOf(
+	&Program{}, &Comment{},
+	&LetStatement{}, &ReturnStatement{}, &ThrowStatement{}, &ExpressionStatement{}, &BlockStatement{},
+	&PrefixExpression{}, &InfixExpression{}, &IfExpression{}, &TryExpression{}, &CallExpression{},
+	&IndexExpression{}, &SliceExpression{}, &MatchExpression{}, &MatchArm{},
+	&IntegerLiteral{}, &StringLiteral{}, &InterpolatedString{}, &Boolean{}, &NullLiteral{}, &Identifier{},
+	&FunctionLiteral{}, &MacroLiteral{}, &ArrayLiteral{}, &HashLiteral{},
+	&ArrayPattern{}, &HashPattern{}, &WildcardPattern{}, &LiteralPattern{},
+)
+
+func kindsOf(nodes ...Node) map[string]reflect.Type {
+	kinds := map[string]reflect.Type{}
+	for _, node := range nodes {
+		t := reflect.TypeOf(node).Elem()
+		kinds[t.Name()] = t
+	}
+	return kinds
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+// EncodeJSON encodes node and everything below it. Each node becomes an
+// object with its "kind", the type name, followed by its fields named in
+// lower camel case: the token with its position, children as nested
+// nodes and everything else as plain values.
+func EncodeJSON(node Node) ([]byte, error) {
+	if node == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(encodeValue(reflect.ValueOf(node)))
+}
+
+// DecodeJSON decodes a node encoded by EncodeJSON.
+func DecodeJSON(data []byte) (Node, error) {
+	v := reflect.New(nodeType).Elem()
+	if err := decodeValue(v, data); err != nil {
+		return nil, err
+	}
+	node, _ := v.Interface().(Node)
+	return node, nil
+}
+
+// jsonObject keeps its fields in order, which a map wouldn't.
+type jsonObject []jsonField
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field.name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func encodeValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return encodeValue(v.Elem())
+		}
+		obj := jsonObject{{"kind", v.Elem().Type().Name()}}
+		return append(obj, encodeFields(v.Elem())...)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = encodeValue(v.Index(i))
+		}
+		return list
+	case reflect.Struct:
+		if !containsNodes(v.Type()) {
+			return v.Interface()
+		}
+		return jsonObject(encodeFields(v))
+	default:
+		return v.Interface()
+	}
+}
+
+func encodeFields(v reflect.Value) []jsonField {
+	fields := []jsonField{}
+	for i := 0; i < v.NumField(); i++ {
+		fields = append(fields, jsonField{fieldName(v.Type().Field(i)), encodeValue(v.Field(i))})
+	}
+	return fields
+}
+
+// containsNodes tells structs like HashLiteralPair, which need encoding
+// field by field, from ones like token.Token that encoding/json handles.
+func containsNodes(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Interface || ft.Kind() == reflect.Pointer {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldName(field reflect.StructField) string {
+	r, size := utf8.DecodeRuneInString(field.Name)
+	return string(unicode.ToLower(r)) + field.Name[size:]
+}
+
+func decodeValue(v reflect.Value, data json.RawMessage) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if string(data) == "null" {
+			return nil
+		}
+		node, err := decodeNode(data)
+		if err != nil {
+			return err
+		}
+		if !node.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("%s can't be used as %s", node.Elem().Type().Name(), v.Type())
+		}
+		v.Set(node)
+		return nil
+	case reflect.Slice:
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		if list == nil {
+			return nil
+		}
+		v.Set(reflect.MakeSlice(v.Type(), len(list), len(list)))
+		for i, el := range list {
+			if err := decodeValue(v.Index(i), el); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		if !containsNodes(v.Type()) {
+			return json.Unmarshal(data, v.Addr().Interface())
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		return decodeFields(v, fields)
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+func decodeNode(data json.RawMessage) (reflect.Value, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return reflect.Value{}, err
+	}
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil {
+		return reflect.Value{}, fmt.Errorf("node without a kind: %s", data)
+	}
+	t, ok := nodeKinds[kind]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown node kind %q", kind)
+	}
+
+	node := reflect.New(t)
+	if err := decodeFields(node.Elem(), fields); err != nil {
+		return reflect.Value{}, fmt.Errorf("%s: %w", kind, err)
+	}
+	return node, nil
+}
+
+func decodeFields(v reflect.Value, fields map[string]json.RawMessage) error {
+	for i := 0; i < v.NumField(); i++ {
+		name := fieldName(v.Type().Field(i))
+		data, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(v.Field(i), data); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
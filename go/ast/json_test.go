@@ -0,0 +1,73 @@
+package ast_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"alde.nu/mint/ast"
+)
+
+func Test_JSONRoundTrip(t *testing.T) {
+	program := parse(t, "// about x\n"+everyNode)
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("decoded program differs.\nwant=%s\ngot= %s", program, decoded)
+	}
+}
+
+func Test_EncodeJSON(t *testing.T) {
+	program := parse(t, "-x")
+
+	data, err := ast.EncodeJSON(program.Statements[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `{"kind":"ExpressionStatement",` +
+		`"token":{"type":"-","literal":"-","pos":{"line":1,"column":1}},` +
+		`"expression":{"kind":"PrefixExpression",` +
+		`"token":{"type":"-","literal":"-","pos":{"line":1,"column":1}},` +
+		`"operator":"-",` +
+		`"right":{"kind":"Identifier",` +
+		`"token":{"type":"IDENT","literal":"x","pos":{"line":1,"column":2}},` +
+		`"value":"x"}}}`
+	if string(data) != expected {
+		t.Errorf("wrong encoding.\nwant=%s\ngot= %s", expected, data)
+	}
+}
+
+func Test_DecodeJSONErrors(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nope"}`, `unknown node kind "Nope"`},
+		{`{"value":"x"}`, `node without a kind`},
+		{
+			`{"kind":"ExpressionStatement","expression":{"kind":"LetStatement"}}`,
+			"ExpressionStatement: expression: LetStatement can't be used as ast.Expression",
+		},
+		{`[1]`, "cannot unmarshal array"},
+	}
+
+	for _, tt := range testData {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %s. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
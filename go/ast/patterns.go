@@ -0,0 +1,139 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+
+	"alde.nu/mint/token"
+)
+
+// Pattern is the left side of a destructuring let. An Identifier is the
+// simplest pattern, binding the whole value.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+func (i *Identifier) patternNode() {}
+
+// ArrayPattern binds array elements by position, as in [a, b, ...rest].
+type ArrayPattern struct {
+	Token    token.Token // the token.LBRACKET token
+	Elements []Pattern
+	Rest     *Identifier // nil without ...rest
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// WildcardPattern is _, which matches anything without binding it.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) Pos() token.Position  { return wp.Token.Pos }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// LiteralPattern matches values equal to an integer, string, boolean or
+// null literal. It is only allowed in match arms.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) Pos() token.Position  { return lp.Token.Pos }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// HashPattern binds hash values by key, as in {name, age: years, ...rest}.
+type HashPattern struct {
+	Token token.Token // the token.LBRACE token
+	Pairs []HashPatternPair
+	Rest  *Identifier // nil without ...rest
+}
+
+// HashPatternPair binds the value under the string Key to Value. In the
+// shorthand {name}, Value is an Identifier named after the key.
+type HashPatternPair struct {
+	Key   string
+	Value Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		if ident, ok := pair.Value.(*Identifier); ok && ident.Value == pair.Key {
+			pairs = append(pairs, pair.Key)
+			continue
+		}
+		key := pair.Key
+		if !IsIdentifierName(key) {
+			key = strconv.Quote(key)
+		}
+		pairs = append(pairs, key+": "+pair.Value.String())
+	}
+	if hp.Rest != nil {
+		pairs = append(pairs, "..."+hp.Rest.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// IsIdentifierName reports whether s can be written as a bare identifier,
+// such as a hash pattern key without quotes.
+func IsIdentifierName(s string) bool {
+	if s == "" || token.LookupIdentifier(s) != token.IDENT {
+		return false
+	}
+	for _, ch := range s {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// PatternIdentifiers returns the identifiers a pattern binds, depth first
+// and left to right.
+func PatternIdentifiers(pattern Pattern) []*Identifier {
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		return []*Identifier{pattern}
+	case *ArrayPattern:
+		idents := []*Identifier{}
+		for _, el := range pattern.Elements {
+			idents = append(idents, PatternIdentifiers(el)...)
+		}
+		if pattern.Rest != nil {
+			idents = append(idents, pattern.Rest)
+		}
+		return idents
+	case *HashPattern:
+		idents := []*Identifier{}
+		for _, pair := range pattern.Pairs {
+			idents = append(idents, PatternIdentifiers(pair.Value)...)
+		}
+		if pattern.Rest != nil {
+			idents = append(idents, pattern.Rest)
+		}
+		return idents
+	default:
+		return nil
+	}
+}
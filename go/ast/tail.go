@@ -0,0 +1,47 @@
+package ast
+
+// TailCalls returns the calls in the body of fn whose value is what fn
+// returns: the last expression of the body and the values of its returns,
+// and the branches of ifs and arms of matches in those places. Nothing is
+// left to do in fn after them, so they can take over its frame. Calls in
+// try expressions are left out, leaving those has to undo the try first.
+func TailCalls(fn *FunctionLiteral) map[*CallExpression]bool {
+	calls := map[*CallExpression]bool{}
+
+	var tail func(node Node)
+	tail = func(node Node) {
+		switch node := node.(type) {
+		case *BlockStatement:
+			if len(node.Statements) > 0 {
+				tail(node.Statements[len(node.Statements)-1])
+			}
+		case *ExpressionStatement:
+			tail(node.Expression)
+		case *ReturnStatement:
+			tail(node.ReturnValue)
+		case *IfExpression:
+			tail(node.Consequence)
+			if node.Alternative != nil {
+				tail(node.Alternative)
+			}
+		case *MatchExpression:
+			for _, arm := range node.Arms {
+				tail(arm.Body)
+			}
+		case *CallExpression:
+			calls[node] = true
+		}
+	}
+
+	tail(fn.Body)
+	Inspect(fn.Body, func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral, *TryExpression:
+			return false
+		case *ReturnStatement:
+			tail(node)
+		}
+		return true
+	})
+	return calls
+}
@@ -0,0 +1,180 @@
+package ast_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"alde.nu/mint/ast"
+	"alde.nu/mint/lexer"
+	"alde.nu/mint/parser"
+)
+
+// everyNode parses into a program using every node type at least once.
+const everyNode = `
+let x = -1 + 2;
+let [a, _, ...rest] = [1, 2, 3];
+let {name, age: years, ...others} = {"name": "mint", "age": 1};
+let add = fn(a, b) { return a + b; };
+let twice = macro(e) { quote(unquote(e) + unquote(e)); };
+if (true) { add(1, 2) } else { null };
+rest[0:1][0];
+try { throw "x"; } catch (e) { e } finally { null };
+"${x} is ${add(1, 2)}";
+match (x) {
+	0 => "zero",
+	[1, ...tail] if len(tail) > 0 => tail,
+	{"k": v} => v,
+	_ => "other",
+};
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.Create(lexer.Create(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func Test_InspectVisitsEveryNodeType(t *testing.T) {
+	program := parse(t, everyNode)
+
+	seen := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			seen[fmt.Sprintf("%T", node)] = true
+		}
+		return true
+	})
+
+	expected := []ast.Node{
+		&ast.Program{},
+		&ast.LetStatement{},
+		&ast.ReturnStatement{},
+		&ast.ThrowStatement{},
+		&ast.ExpressionStatement{},
+		&ast.BlockStatement{},
+		&ast.PrefixExpression{},
+		&ast.InfixExpression{},
+		&ast.IfExpression{},
+		&ast.TryExpression{},
+		&ast.CallExpression{},
+		&ast.IndexExpression{},
+		&ast.SliceExpression{},
+		&ast.MatchExpression{},
+		&ast.MatchArm{},
+		&ast.IntegerLiteral{},
+		&ast.StringLiteral{},
+		&ast.InterpolatedString{},
+		&ast.Boolean{},
+		&ast.NullLiteral{},
+		&ast.Identifier{},
+		&ast.FunctionLiteral{},
+		&ast.MacroLiteral{},
+		&ast.ArrayLiteral{},
+		&ast.HashLiteral{},
+		&ast.ArrayPattern{},
+		&ast.HashPattern{},
+		&ast.WildcardPattern{},
+		&ast.LiteralPattern{},
+	}
+	for _, node := range expected {
+		name := fmt.Sprintf("%T", node)
+		if !seen[name] {
+			t.Errorf("%s was not visited", name)
+		}
+	}
+}
+
+func Test_InspectOrderAndPruning(t *testing.T) {
+	program := parse(t, `let a = f(1, [2, 3]);`)
+
+	idents := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			idents = append(idents, node.Value)
+		case *ast.IntegerLiteral:
+			idents = append(idents, node.String())
+		case *ast.ArrayLiteral:
+			return false
+		}
+		return true
+	})
+
+	expected := []string{"a", "f", "1"}
+	if !reflect.DeepEqual(idents, expected) {
+		t.Errorf("wrong visiting order. want=%v, got=%v", expected, idents)
+	}
+}
+
+// depthVisitor checks that every visited node is closed by a nil visit.
+type depthVisitor struct {
+	depth    *int
+	maxDepth *int
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depth++
+	if *v.depth > *v.maxDepth {
+		*v.maxDepth = *v.depth
+	}
+	return v
+}
+
+func Test_WalkBalancesNilVisits(t *testing.T) {
+	program := parse(t, everyNode)
+
+	depth, maxDepth := 0, 0
+	ast.Walk(depthVisitor{&depth, &maxDepth}, program)
+
+	if depth != 0 {
+		t.Errorf("unbalanced walk, ended at depth %d", depth)
+	}
+	if maxDepth < 5 {
+		t.Errorf("walk didn't descend, max depth %d", maxDepth)
+	}
+}
+
+func Test_ModifyReachesEveryNodeType(t *testing.T) {
+	walked := map[string]int{}
+	ast.Inspect(parse(t, everyNode), func(node ast.Node) bool {
+		if node != nil {
+			walked[fmt.Sprintf("%T", node)]++
+		}
+		return true
+	})
+
+	modified := map[string]int{}
+	ast.Modify(parse(t, everyNode), func(node ast.Node) ast.Node {
+		modified[fmt.Sprintf("%T", node)]++
+		return node
+	})
+
+	if !reflect.DeepEqual(walked, modified) {
+		t.Errorf("Modify and Walk disagree.\nwalk=%v\nmodify=%v", walked, modified)
+	}
+}
+
+func Test_ModifyRenamesIdentifiers(t *testing.T) {
+	program := parse(t, `let [a, ...b] = a; match (a) { {"k": a} => a };`)
+
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == "a" {
+			ident.Value = "z"
+		}
+		return node
+	})
+
+	expected := `let [z, ...b] = z;match (z) { {k: z} => z }`
+	if program.String() != expected {
+		t.Errorf("not equal. want=%q, got=%q", expected, program.String())
+	}
+}
@@ -9,7 +9,69 @@ type Opcode byte
 
 const (
 	OpConstant Opcode = iota
+	OpPop
 	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+	OpLessThan
+	OpLessThanOrEqual
+	OpMinus
+	OpBang
+	OpBitNot
+	OpTrue
+	OpFalse
+	OpNull
+	OpJump
+	OpJumpNotTruthy
+	// OpJumpNotTruthyOrPop jumps if the top of the stack is falsy, leaving it
+	// in place as the result. Otherwise the value is popped.
+	OpJumpNotTruthyOrPop
+	// OpJumpTruthyOrPop is the inverse of OpJumpNotTruthyOrPop.
+	OpJumpTruthyOrPop
+	// OpJumpNotNullOrPop is OpJumpTruthyOrPop, testing for null instead.
+	OpJumpNotNullOrPop
+	// OpJumpNull jumps if the top of the stack is null, leaving it in place
+	// either way.
+	OpJumpNull
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpCurrentClosure
+	OpArray
+	OpHash
+	OpIndex
+	// OpSlice slices the value below the low and high bounds on the stack.
+	// An omitted bound is pushed as null.
+	OpSlice
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+	OpDestructureArray
+	OpDestructureHash
+	OpMatch
+	OpInterpolate
+	OpTry
+	OpEndTry
+	OpThrow
+	OpTailCall
+	OpTryFinally
+	OpRethrow
 )
 
 type Definition struct {
@@ -18,8 +80,89 @@ type Definition struct {
 }
 
 var definitions = map[Opcode]*Definition{
-	OpConstant: {"OpConstant", []int{2}},
-	OpAdd:      {"OpAdd", []int{}},
+	OpConstant:           {"OpConstant", []int{2}},
+	OpPop:                {"OpPop", []int{}},
+	OpAdd:                {"OpAdd", []int{}},
+	OpSub:                {"OpSub", []int{}},
+	OpMul:                {"OpMul", []int{}},
+	OpDiv:                {"OpDiv", []int{}},
+	OpMod:                {"OpMod", []int{}},
+	OpPow:                {"OpPow", []int{}},
+	OpBitAnd:             {"OpBitAnd", []int{}},
+	OpBitOr:              {"OpBitOr", []int{}},
+	OpBitXor:             {"OpBitXor", []int{}},
+	OpShiftLeft:          {"OpShiftLeft", []int{}},
+	OpShiftRight:         {"OpShiftRight", []int{}},
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+	OpMinus:              {"OpMinus", []int{}},
+	OpBang:               {"OpBang", []int{}},
+	OpBitNot:             {"OpBitNot", []int{}},
+	OpTrue:               {"OpTrue", []int{}},
+	OpFalse:              {"OpFalse", []int{}},
+	OpNull:               {"OpNull", []int{}},
+	OpJump:               {"OpJump", []int{2}},
+	OpJumpNotTruthy:      {"OpJumpNotTruthy", []int{2}},
+
+	OpJumpNotTruthyOrPop: {"OpJumpNotTruthyOrPop", []int{2}},
+	OpJumpTruthyOrPop:    {"OpJumpTruthyOrPop", []int{2}},
+	OpJumpNotNullOrPop:   {"OpJumpNotNullOrPop", []int{2}},
+	OpJumpNull:           {"OpJumpNull", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpCall:           {"OpCall", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	// OpClosure takes the constant index of the function and the number of
+	// free variables sitting on the stack
+	OpClosure: {"OpClosure", []int{2, 1}},
+	// OpDestructureArray takes the number of elements in the pattern and
+	// whether it ends in ...rest. It replaces the array on the stack with
+	// its elements, the first one on top, and the rest array below them.
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1}},
+	// OpDestructureHash takes the constant index of an array holding the
+	// pattern's keys and whether it ends in ...rest. Like
+	// OpDestructureArray, it leaves the first value on top.
+	OpDestructureHash: {"OpDestructureHash", []int{2, 1}},
+	// OpMatch takes the constant index of a match pattern and tests the
+	// value on top of the stack against it, leaving the value in place. On
+	// a match it pushes the bound values, the first one on top, followed by
+	// true. Otherwise it only pushes false.
+	OpMatch: {"OpMatch", []int{2}},
+	// OpInterpolate takes the number of parts of an interpolated string,
+	// its text parts and the values of its expressions in turn, and
+	// replaces them with the string they make up.
+	OpInterpolate: {"OpInterpolate", []int{2}},
+	// OpTry adds a handler to the VM's exception handler table for the
+	// instructions up to the matching OpEndTry, which removes it again. The
+	// operand is where the handler starts: with the stack as it was at the
+	// OpTry and the caught error pushed on top.
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	// OpThrow throws the value on top of the stack.
+	OpThrow: {"OpThrow", []int{}},
+	// OpTailCall is an OpCall whose value the calling function returns. The
+	// function called takes over the caller's frame instead of adding one.
+	OpTailCall: {"OpTailCall", []int{1}},
+	// OpTryFinally is an OpTry whose handler is a finally block. It gets
+	// the error itself pushed, not what a catch would bind, for OpRethrow
+	// to throw again as it was once the block has run.
+	OpTryFinally: {"OpTryFinally", []int{2}},
+	OpRethrow:    {"OpRethrow", []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -50,6 +193,8 @@ func Make(op Opcode, operands ...int) []byte {
 		switch width {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
 		}
 		offset += width
 	}
@@ -64,6 +209,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 		switch width {
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		}
 		offset += width
 	}
@@ -73,3 +220,7 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -1,6 +1,10 @@
 package code
 
-import "testing"
+import (
+	"testing"
+
+	"alde.nu/mint/token"
+)
 
 func Test_Make(t *testing.T) {
 	testData := []struct {
@@ -10,6 +14,9 @@ func Test_Make(t *testing.T) {
 	}{
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpJumpNotTruthyOrPop, []int{258}, []byte{byte(OpJumpNotTruthyOrPop), 1, 2}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
 	}
 
 	for _, td := range testData {
@@ -29,13 +36,17 @@ func Test_Make(t *testing.T) {
 func Test_InstructionsString(t *testing.T) {
 	instructions := []Instructions{
 		Make(OpAdd),
+		Make(OpGetLocal, 1),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
 	}
 
 	expected := `0000 OpAdd
-0001 OpConstant 2
-0004 OpConstant 65535
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
 `
 	concatted := Instructions{}
 	for _, ins := range instructions {
@@ -54,6 +65,8 @@ func Test_ReadOperands(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
 	}
 
 	for _, tt := range tests {
@@ -76,3 +89,35 @@ func Test_ReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func Test_Positions(t *testing.T) {
+	var positions Positions
+	positions = positions.Add(0, token.Position{Line: 1, Column: 1})
+	positions = positions.Add(3, token.Position{Line: 1, Column: 1})
+	positions = positions.Add(4, token.Position{Line: 2, Column: 5})
+	positions = positions.Add(7, token.Position{Line: 3, Column: 2})
+	positions = positions.Truncate(7)
+	positions = positions.Add(7, token.Position{Line: 4, Column: 1})
+
+	if len(positions) != 3 {
+		t.Fatalf("wrong number of entries. want=3, got=%d", len(positions))
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{-1, token.Position{}},
+		{0, token.Position{Line: 1, Column: 1}},
+		{3, token.Position{Line: 1, Column: 1}},
+		{5, token.Position{Line: 2, Column: 5}},
+		{7, token.Position{Line: 4, Column: 1}},
+		{100, token.Position{Line: 4, Column: 1}},
+	}
+
+	for _, tt := range tests {
+		if pos := positions.Lookup(tt.offset); pos != tt.expected {
+			t.Errorf("Lookup(%d) wrong. want=%s, got=%s", tt.offset, tt.expected, pos)
+		}
+	}
+}
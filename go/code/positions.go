@@ -0,0 +1,43 @@
+package code
+
+import (
+	"sort"
+
+	"alde.nu/mint/token"
+)
+
+// Positions maps instruction offsets back to the source they were compiled
+// from. Each entry covers the instructions from its offset up to the next
+// entry's, and entries are sorted by offset.
+type Positions []PositionEntry
+
+type PositionEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Add records that the instructions from offset on come from pos.
+func (p Positions) Add(offset int, pos token.Position) Positions {
+	if n := len(p); n > 0 && p[n-1].Pos == pos {
+		return p
+	}
+	return append(p, PositionEntry{Offset: offset, Pos: pos})
+}
+
+// Truncate drops the entries for the instructions from offset on.
+func (p Positions) Truncate(offset int) Positions {
+	for len(p) > 0 && p[len(p)-1].Offset >= offset {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// Lookup returns the position of the instruction at offset, or of the one
+// offset is within. It's the zero Position if nothing covers offset.
+func (p Positions) Lookup(offset int) token.Position {
+	i := sort.Search(len(p), func(i int) bool { return p[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return p[i-1].Pos
+}
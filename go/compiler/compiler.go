@@ -6,21 +6,113 @@ import (
 	"alde.nu/mint/ast"
 	"alde.nu/mint/code"
 	"alde.nu/mint/object"
+	"alde.nu/mint/token"
 )
 
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterThanOrEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessThanOrEqual,
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"!": code.OpBang,
+	"~": code.OpBitNot,
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function currently being
+// compiled, the outermost one being the main program.
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	positions           code.Positions
+	tries               []tryBlock // the ones being compiled, innermost last
+	tailCalls           map[*ast.CallExpression]bool
+}
+
+// tryBlock is what a return has to undo when leaving the try or catch
+// block of a try expression: its handler and then its finally block.
+type tryBlock struct {
+	handler bool
+	finally *ast.BlockStatement
+}
+
 type Compiler struct {
-	instructions code.Instructions
-	constants    []object.Object
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	position token.Position // of the innermost node being compiled
 }
 
 func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
 	return &Compiler{
-		instructions: code.Instructions{},
-		constants:    []object.Object{},
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
 	}
 }
 
+// NewWithState creates a compiler that continues where a previous one
+// left off, which is what keeps definitions alive between REPL lines.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// SymbolTable returns the global symbol table, to be handed to
+// NewWithState.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
+	// Instructions are mapped to the innermost node they are emitted for.
+	// Nodes made up by macros have no position and keep their parent's.
+	if pos := node.Pos(); pos.Line > 0 {
+		outer := c.position
+		c.position = pos
+		defer func() { c.position = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -33,24 +125,181 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err := c.Compile(node.Expression); err != nil {
 			return err
 		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			return c.compilePattern(node.Pattern)
+		}
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.unwindTryBlocks(); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" || node.Operator == "??" {
+			return c.compileLogicalExpression(node)
+		}
 		if err := c.Compile(node.Left); err != nil {
 			return err
 		}
 		if err := c.Compile(node.Right); err != nil {
 			return err
 		}
-		switch node.Operator {
-		case "+":
-			c.emit(code.OpAdd)
-		default:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
 
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.InterpolatedString:
+		for i, text := range node.Strings {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: text}))
+			if i < len(node.Expressions) {
+				if err := c.Compile(node.Expressions[i]); err != nil {
+					return err
+				}
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Strings)+len(node.Expressions))
+
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		jumpNullPos := c.emitOptionalJump(node.Optional)
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+		c.patchOptionalJump(jumpNullPos)
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		jumpNullPos := c.emitOptionalJump(node.Optional)
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+			} else if err := c.Compile(bound); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+		c.patchOptionalJump(jumpNullPos)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literals must be bound with a top-level let")
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		jumpNullPos := c.emitOptionalJump(node.Optional)
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		if c.scopes[c.scopeIndex].tailCalls[node] {
+			c.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+		c.patchOptionalJump(jumpNullPos)
 	}
 
 	return nil
@@ -58,8 +307,367 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
-		Instructions: c.instructions,
+		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Positions:    c.scopes[c.scopeIndex].positions,
+	}
+}
+
+// compileLogicalExpression emits the left operand followed by a conditional
+// jump over the right operand, so the right side only runs when the left
+// one doesn't already decide the result.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	var jumpOp code.Opcode
+	switch node.Operator {
+	case "&&":
+		jumpOp = code.OpJumpNotTruthyOrPop
+	case "||":
+		jumpOp = code.OpJumpTruthyOrPop
+	case "??":
+		jumpOp = code.OpJumpNotNullOrPop
+	}
+	// Bogus operand, patched once we know where the right side ends
+	jumpPos := c.emit(jumpOp, 9999)
+
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// emitOptionalJump starts a safe navigation a?.[i] or f?.(), jumping past
+// the index or call when its left side is null so the null is the result.
+// It returns -1 when the expression isn't optional.
+func (c *Compiler) emitOptionalJump(optional bool) int {
+	if !optional {
+		return -1
+	}
+	// Bogus operand, patched by patchOptionalJump
+	return c.emit(code.OpJumpNull, 9999)
+}
+
+func (c *Compiler) patchOptionalJump(pos int) {
+	if pos >= 0 {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+// compilePattern stores the value on top of the stack into the variables
+// of a destructuring let.
+func (c *Compiler) compilePattern(pattern ast.Pattern) error {
+	var targets []ast.Pattern
+	var rest *ast.Identifier
+
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		c.emit(code.OpPop)
+		return nil
+	case *ast.Identifier:
+		c.storeSymbol(c.symbolTable.Define(pattern.Value))
+		return nil
+	case *ast.ArrayPattern:
+		targets, rest = pattern.Elements, pattern.Rest
+		c.emit(code.OpDestructureArray, len(targets), boolOperand(rest != nil))
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			keys[i] = &object.String{Value: pair.Key}
+			targets = append(targets, pair.Value)
+		}
+		rest = pattern.Rest
+		keysIndex := c.addConstant(&object.Array{Elements: keys})
+		c.emit(code.OpDestructureHash, keysIndex, boolOperand(rest != nil))
+	default:
+		return fmt.Errorf("unknown pattern: %T", pattern)
+	}
+
+	for _, target := range targets {
+		if err := c.compilePattern(target); err != nil {
+			return err
+		}
+	}
+	if rest != nil {
+		return c.compilePattern(rest)
+	}
+	return nil
+}
+
+// compileMatchExpression keeps the subject on the stack while trying each
+// arm in turn. An arm that fails its pattern or its guard jumps to the next
+// one, and the first to succeed pops the subject, leaves its body's value
+// and jumps to the end. Without a match the result is null.
+//
+// Patterns are not compiled to instructions: each is kept as a constant
+// that OpMatch hands to object.Match, the same code the evaluator uses.
+// The bindings of an arm and whatever its body defines are in a block of
+// their own, so they hide variables of the same name only in that arm.
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+
+	jumpToEndPositions := []int{}
+	for _, arm := range node.Arms {
+		patternIndex := c.addConstant(&object.MatchPattern{Pattern: arm.Pattern})
+		c.emit(code.OpMatch, patternIndex)
+		// Bogus operands, patched once we know where the next arm starts
+		nextArmPositions := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		c.symbolTable.OpenBlock()
+		for _, ident := range ast.PatternIdentifiers(arm.Pattern) {
+			c.storeSymbol(c.symbolTable.Define(ident.Value))
+		}
+
+		if arm.Guard != nil {
+			if err := c.Compile(arm.Guard); err != nil {
+				return err
+			}
+			nextArmPositions = append(nextArmPositions, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		c.emit(code.OpPop)
+		if err := c.compileArmBody(arm.Body); err != nil {
+			return err
+		}
+		c.symbolTable.CloseBlock()
+		jumpToEndPositions = append(jumpToEndPositions, c.emit(code.OpJump, 9999))
+
+		for _, pos := range nextArmPositions {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+	}
+
+	c.emit(code.OpPop)
+	c.emit(code.OpNull)
+
+	for _, pos := range jumpToEndPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileArmBody(body ast.Expression) error {
+	if block, ok := body.(*ast.BlockStatement); ok {
+		return c.compileBlockValue(block)
+	}
+	return c.Compile(body)
+}
+
+func boolOperand(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// Bogus operand, patched once we know where the consequence ends
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		if err := c.compileBlockValue(node.Alternative); err != nil {
+			return err
+		}
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileTryExpression guards the try block with a handler that jumps to
+// the catch block. The finally block is compiled after each of them and,
+// when there is one, once more in a handler that throws the error again
+// after it, for errors escaping the try block without a catch or escaping
+// the catch block.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	// Bogus operands, patched once we know where the handlers start
+	tryOp := code.OpTry
+	if node.Catch == nil {
+		tryOp = code.OpTryFinally
+	}
+	tryPos := c.emit(tryOp, 9999)
+	if err := c.compileTryBlock(node.Block, tryBlock{handler: true, finally: node.Finally}); err != nil {
+		return err
+	}
+	jumpToEndPositions := []int{c.emit(code.OpJump, 9999)}
+	rethrowPositions := []int{}
+
+	if node.Catch != nil {
+		c.changeOperand(tryPos, len(c.currentInstructions()))
+		catch := tryBlock{handler: node.Finally != nil, finally: node.Finally}
+		if catch.handler {
+			rethrowPositions = append(rethrowPositions, c.emit(code.OpTryFinally, 9999))
+		}
+		c.storeSymbol(c.symbolTable.Define(node.Parameter.Value))
+		if err := c.compileTryBlock(node.Catch, catch); err != nil {
+			return err
+		}
+		if node.Finally != nil {
+			jumpToEndPositions = append(jumpToEndPositions, c.emit(code.OpJump, 9999))
+		}
+	} else {
+		rethrowPositions = append(rethrowPositions, tryPos)
+	}
+
+	if node.Finally != nil {
+		for _, pos := range rethrowPositions {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+		if err := c.Compile(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpRethrow)
+	}
+
+	for _, pos := range jumpToEndPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileTryBlock compiles the try or catch block of a try expression,
+// leaving its value, followed by what leaving it normally has to undo.
+func (c *Compiler) compileTryBlock(block *ast.BlockStatement, try tryBlock) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, try)
+	err := c.compileBlockValue(block)
+	scope = &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	if err != nil {
+		return err
+	}
+
+	if try.handler {
+		c.emit(code.OpEndTry)
+	}
+	if try.finally != nil {
+		return c.Compile(try.finally)
+	}
+	return nil
+}
+
+// unwindTryBlocks undoes the try blocks a return leaves, from the
+// innermost out, with the return value kept on the stack.
+func (c *Compiler) unwindTryBlocks() error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= 0; i-- {
+		// A return in the finally block only leaves the outer ones
+		c.scopes[c.scopeIndex].tries = append([]tryBlock{}, tries[:i]...)
+		if tries[i].handler {
+			c.emit(code.OpEndTry)
+		}
+		if tries[i].finally != nil {
+			if err := c.Compile(tries[i].finally); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileBlockValue compiles a block whose last value stays on the stack
+// as the value of the surrounding expression. Blocks that don't end in an
+// expression produce null, like they do in the evaluator.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+	c.scopes[c.scopeIndex].tailCalls = ast.TailCalls(node)
+
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		MaxStack:      maxStackDepth(instructions, c.constants),
+		Name:          node.Name,
+		Positions:     positions,
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
 	}
 }
 
@@ -74,16 +682,95 @@ func (c *Compiler) addConstant(obj object.Object) int {
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
+	c.scopes[c.scopeIndex].positions = c.scopes[c.scopeIndex].positions.Add(pos, c.position)
+
+	c.setLastInstruction(op, pos)
+
 	return pos
 }
 
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	c.scopes[c.scopeIndex].instructions = old[:last.Position]
+	c.scopes[c.scopeIndex].positions = c.scopes[c.scopeIndex].positions.Truncate(last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
-	posNewInstruction := len(c.instructions)
-	c.instructions = append(c.instructions, ins...)
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
 	return posNewInstruction
 }
 
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Positions    code.Positions // of Instructions, functions have their own
 }
@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"alde.nu/mint/ast"
+	"alde.nu/mint/code"
+	"alde.nu/mint/object"
+)
+
+// maxStackDepth works out the most values the instructions of a function
+// have on the stack at once, on top of its locals, so a call can tell if
+// there is room for them before it starts. Jumps are followed: the depth
+// where one lands is the largest of the ways there, and code only reached
+// by a jump starts from it. Where that can't be known for sure, like which
+// of OpMatch's results comes out, the larger count is taken.
+func maxStackDepth(ins code.Instructions, constants []object.Object) int {
+	landing := map[int]int{} // the depth at jump targets and handlers
+	depth, max := 0, 0
+	fallsThrough := true
+
+	for ip := 0; ip < len(ins); {
+		if d, ok := landing[ip]; ok && (!fallsThrough || d > depth) {
+			depth = d
+			if depth > max {
+				max = depth
+			}
+		}
+		fallsThrough = true
+
+		op := code.Opcode(ins[ip])
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return max
+		}
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+		ip += 1 + read
+
+		depth += stackEffect(op, operands, constants)
+		if depth > max {
+			max = depth
+		}
+
+		switch op {
+		case code.OpJump:
+			land(landing, operands[0], depth)
+			fallsThrough = false
+		case code.OpJumpNotTruthy, code.OpJumpNull:
+			land(landing, operands[0], depth)
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop, code.OpJumpNotNullOrPop:
+			// Only popped when they don't jump
+			land(landing, operands[0], depth+1)
+		case code.OpTry, code.OpTryFinally:
+			// The handler starts with the caught error pushed
+			land(landing, operands[0], depth+1)
+		case code.OpReturnValue, code.OpReturn, code.OpThrow, code.OpRethrow:
+			fallsThrough = false
+		}
+	}
+	return max
+}
+
+func land(landing map[int]int, target, depth int) {
+	if d, ok := landing[target]; !ok || depth > d {
+		landing[target] = depth
+	}
+}
+
+// stackEffect is how many values op leaves on the stack minus how many it
+// takes off, counting the conditional jumps as not jumping.
+func stackEffect(op code.Opcode, operands []int, constants []object.Object) int {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure:
+		return 1
+	case code.OpPop, code.OpSetGlobal, code.OpSetLocal, code.OpJumpNotTruthy,
+		code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop, code.OpJumpNotNullOrPop,
+		code.OpIndex, code.OpReturnValue, code.OpThrow, code.OpRethrow,
+		code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual,
+		code.OpLessThan, code.OpLessThanOrEqual:
+		return -1
+	case code.OpSlice:
+		return -2
+	case code.OpArray, code.OpHash, code.OpInterpolate:
+		return 1 - operands[0]
+	case code.OpCall, code.OpTailCall:
+		// The callee and arguments make way for the result
+		return -operands[0]
+	case code.OpClosure:
+		return 1 - operands[1]
+	case code.OpDestructureArray:
+		return operands[0] + operands[1] - 1
+	case code.OpDestructureHash:
+		keys := constants[operands[0]].(*object.Array)
+		return len(keys.Elements) + operands[1] - 1
+	case code.OpMatch:
+		pattern := constants[operands[0]].(*object.MatchPattern)
+		return len(ast.PatternIdentifiers(pattern.Pattern)) + 1
+	default:
+		// OpMinus, OpBang, OpBitNot, OpJump, OpJumpNull, OpReturn, OpTry,
+		// OpTryFinally and OpEndTry
+		return 0
+	}
+}
@@ -0,0 +1,142 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	blocks         []map[string]*Symbol // what names defined in each open block hid, innermost last
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store:       make(map[string]Symbol),
+		FreeSymbols: []Symbol{},
+	}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define gives name a slot in this scope. A name defined again, or in code
+// that is compiled twice like a finally block, keeps the slot it has, so
+// it is overwritten like a variable in the evaluator's environment.
+func (s *SymbolTable) Define(name string) Symbol {
+	if len(s.blocks) > 0 {
+		return s.defineInBlock(name)
+	}
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+	return s.define(name)
+}
+
+func (s *SymbolTable) define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// OpenBlock starts a block whose names go away at CloseBlock, such as the
+// bindings of a match arm. A name defined in the block gets a slot of its
+// own, leaving alone the variable it hides.
+func (s *SymbolTable) OpenBlock() {
+	s.blocks = append(s.blocks, map[string]*Symbol{})
+}
+
+// CloseBlock ends the innermost block, making the names defined in it
+// refer to what they did before it.
+func (s *SymbolTable) CloseBlock() {
+	block := s.blocks[len(s.blocks)-1]
+	s.blocks = s.blocks[:len(s.blocks)-1]
+	for name, hidden := range block {
+		if hidden != nil {
+			s.store[name] = *hidden
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
+
+func (s *SymbolTable) defineInBlock(name string) Symbol {
+	block := s.blocks[len(s.blocks)-1]
+	if _, ok := block[name]; ok {
+		return s.store[name]
+	}
+
+	if hidden, ok := s.store[name]; ok {
+		block[name] = &hidden
+	} else {
+		block[name] = nil
+	}
+	return s.define(name)
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName lets a function refer to itself by the name it is
+// bound to, without that name being resolved as a free variable.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in this and all enclosing tables. Locals of an
+// enclosing function come back as free variables of this one.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		symbol, ok = s.Outer.Resolve(name)
+		if !ok {
+			return symbol, ok
+		}
+
+		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+			return symbol, ok
+		}
+
+		return s.defineFree(symbol), true
+	}
+	return symbol, ok
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
@@ -0,0 +1,108 @@
+package compiler
+
+import "testing"
+
+func Test_Define(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+	if c := local.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := local.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+}
+
+func Test_DefineAgain(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	global.Define("b")
+
+	if again := global.Define("a"); again != a {
+		t.Errorf("expected a=%+v, got=%+v", a, again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.Resolve("a")
+	if shadow := local.Define("a"); shadow.Scope != LocalScope || shadow.Index != 0 {
+		t.Errorf("expected a local a at 0, got=%+v", shadow)
+	}
+}
+
+func Test_DefineInBlock(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+
+	global.OpenBlock()
+	inner := global.Define("a")
+	if inner == a {
+		t.Errorf("a defined in a block reuses the slot of the a it hides: %+v", inner)
+	}
+	if again := global.Define("a"); again != inner {
+		t.Errorf("expected a=%+v, got=%+v", inner, again)
+	}
+	b := global.Define("b")
+	global.CloseBlock()
+
+	if resolved, ok := global.Resolve("a"); !ok || resolved != a {
+		t.Errorf("a after the block. expected=%+v, got=%+v", a, resolved)
+	}
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("b defined in the block resolves after it")
+	}
+	if c := global.Define("c"); c.Index <= b.Index {
+		t.Errorf("c reuses a slot of the block: %+v", c)
+	}
+}
+
+func Test_ResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+		{Name: "b", Scope: FreeScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := second.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(second.FreeSymbols) != 1 || second.FreeSymbols[0] != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong free symbols. got=%+v", second.FreeSymbols)
+	}
+
+	if _, ok := second.Resolve("d"); ok {
+		t.Errorf("name d resolved, but was never defined")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type lineEdit struct {
+	kind byte // ' ' for a kept line, '-' for a removed one, '+' for an added one
+	line string
+}
+
+// unifiedDiff describes the changes from before to after in the unified
+// format with three lines of context. It is empty when they're equal.
+func unifiedDiff(path string, before, after []byte) string {
+	if string(before) == string(after) {
+		return ""
+	}
+	edits := diffLines(splitLines(string(before)), splitLines(string(after)))
+
+	const context = 3
+	inHunk := make([]bool, len(edits))
+	for i, e := range edits {
+		if e.kind == ' ' {
+			continue
+		}
+		for j := max(0, i-context); j <= min(len(edits)-1, i+context); j++ {
+			inHunk[j] = true
+		}
+	}
+
+	out := strings.Builder{}
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", path, path)
+
+	beforeLine, afterLine := 1, 1
+	for i := 0; i < len(edits); {
+		if !inHunk[i] {
+			beforeLine++
+			afterLine++
+			i++
+			continue
+		}
+
+		end := i
+		beforeLen, afterLen := 0, 0
+		for ; end < len(edits) && inHunk[end]; end++ {
+			if edits[end].kind != '+' {
+				beforeLen++
+			}
+			if edits[end].kind != '-' {
+				afterLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(beforeLine, beforeLen), hunkRange(afterLine, afterLen))
+		for _, e := range edits[i:end] {
+			out.WriteByte(e.kind)
+			out.WriteString(e.line)
+			out.WriteByte('\n')
+		}
+
+		beforeLine += beforeLen
+		afterLine += afterLen
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		// An empty range names the line before it
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines turns a into b through the longest common subsequence of
+// their lines, removing before adding where lines changed.
+func diffLines(a, b []string) []lineEdit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := []lineEdit{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, lineEdit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, lineEdit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, lineEdit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, lineEdit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, lineEdit{'+', b[j]})
+	}
+	return edits
+}
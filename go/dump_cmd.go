@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"alde.nu/mint/ast"
+	"alde.nu/mint/lexer"
+	"alde.nu/mint/parser"
+	"alde.nu/mint/token"
+)
+
+// runTokens implements `mint tokens [-json] [path]`, printing the tokens
+// the lexer finds in path or in standard input.
+func runTokens(args []string) int {
+	flags := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the tokens as a JSON array")
+	src, status := openSource(flags, "[-json] [path]", args)
+	if status != 0 {
+		return status
+	}
+	defer src.Close()
+
+	l := lexer.CreateFromReader(src)
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	if err := l.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "mint tokens: %s\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		return writeJSON(tokens)
+	}
+	for _, tok := range tokens {
+		fmt.Printf("%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+	return 0
+}
+
+// runAST implements `mint ast [-json] [-trace] [path]`, printing the tree
+// the parser builds from path or from standard input.
+func runAST(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+	trace := flags.Bool("trace", false, "print the rules the parser enters and leaves to standard error")
+	src, status := openSource(flags, "[-json] [-trace] [path]", args)
+	if status != 0 {
+		return status
+	}
+	defer src.Close()
+
+	l := lexer.CreateFromReader(src)
+	l.KeepComments()
+	var opts []parser.Option
+	if *trace {
+		opts = append(opts, parser.WithTrace(os.Stderr))
+	}
+	p := parser.Create(l, opts...)
+	program := p.ParseProgram()
+	if err := l.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "mint ast: %s\n", err)
+		return 1
+	}
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "mint ast: %s\n", msg)
+		}
+		return 1
+	}
+
+	if *asJSON {
+		data, err := ast.EncodeJSON(program)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mint ast: %s\n", err)
+			return 1
+		}
+		return writeJSON(json.RawMessage(data))
+	}
+
+	depth := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+		fmt.Printf("%s%s %s %q\n", strings.Repeat("  ", depth), kind, node.Pos(), node.TokenLiteral())
+		depth++
+		return true
+	})
+	return 0
+}
+
+// openSource returns the file named in args, or standard input when
+// there is none, for the lexer to read as it goes.
+func openSource(flags *flag.FlagSet, synopsis string, args []string) (io.ReadCloser, int) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: mint %s %s\n", flags.Name(), synopsis)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, 2
+	}
+
+	switch flags.NArg() {
+	case 0:
+		return io.NopCloser(os.Stdin), 0
+	case 1:
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mint %s: %s\n", flags.Name(), err)
+			return nil, 1
+		}
+		return f, 0
+	default:
+		flags.Usage()
+		return nil, 2
+	}
+}
+
+func writeJSON(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err == nil {
+		var out bytes.Buffer
+		if err = json.Indent(&out, data, "", "  "); err == nil {
+			out.WriteByte('\n')
+			_, err = out.WriteTo(os.Stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mint: %s\n", err)
+		return 1
+	}
+	return 0
+}
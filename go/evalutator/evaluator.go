@@ -1,126 +1,315 @@
 package evalutator
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"time"
 
 	"alde.nu/mint/ast"
 	"alde.nu/mint/object"
+	"alde.nu/mint/token"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 	NULL  = &object.Null{}
 )
 
+// Evaluator walks the AST and evaluates it directly. The zero value is
+// ready to use, options enable the non-default behaviours.
+type Evaluator struct {
+	caseFold *object.CaseFoldWarnings // nil unless WithCaseFoldWarnings
+
+	maxCallDepth int
+	callDepth    int
+
+	tailCalls map[*ast.CallExpression]bool // of the function literals met so far
+	analysed  map[*ast.FunctionLiteral]bool
+
+	stepLimit   int
+	timeout     time.Duration
+	memoryLimit int64
+	running     bool // whether steps and memory are counting a run
+	steps       object.Steps
+	memory      object.Memory
+	envs        []*object.Environment // the ones being run, innermost last
+}
+
+// DefaultMaxCallDepth is how deep functions can call each other unless
+// WithMaxCallDepth says otherwise. Each call takes several Go frames, so
+// this keeps well clear of Go's own stack limit.
+const DefaultMaxCallDepth = 1024
+
+type Option func(*Evaluator)
+
+// WithMaxCallDepth limits how many function calls can be in progress at
+// once. A call past the limit raises a recursion error instead.
+func WithMaxCallDepth(depth int) Option {
+	return func(e *Evaluator) {
+		e.maxCallDepth = depth
+	}
+}
+
+// WithStepLimit stops a run once it has evaluated more than steps nodes,
+// with an *object.LimitError.
+func WithStepLimit(steps int) Option {
+	return func(e *Evaluator) {
+		e.stepLimit = steps
+	}
+}
+
+// WithTimeout stops a run once it has taken longer than timeout, with an
+// *object.LimitError.
+func WithTimeout(timeout time.Duration) Option {
+	return func(e *Evaluator) {
+		e.timeout = timeout
+	}
+}
+
+// WithMemoryLimit stops a run once the arrays, strings and hashes it
+// built take more than bytes, with an *object.LimitError. See
+// object.Memory for how they are counted.
+func WithMemoryLimit(bytes int64) Option {
+	return func(e *Evaluator) {
+		e.memoryLimit = bytes
+	}
+}
+
+// WithCaseFoldWarnings makes the evaluator record a Warning for every
+// string comparison whose result changed when `==` and `!=` stopped
+// ignoring case. It's meant to help migrating old scripts.
+func WithCaseFoldWarnings() Option {
+	return func(e *Evaluator) {
+		e.caseFold = &object.CaseFoldWarnings{}
+	}
+}
+
+func New(opts ...Option) *Evaluator {
+	e := &Evaluator{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Eval evaluates node with a default Evaluator.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalContext evaluates node with a default Evaluator until ctx is done.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().EvalContext(ctx, node, env)
+}
+
+// MemoryStats reports the memory allocated by the last run.
+func (e *Evaluator) MemoryStats() object.MemoryStats {
+	return e.memory.Stats()
+}
+
+// Warnings returns the warnings recorded so far, one per source location.
+func (e *Evaluator) Warnings() []object.Warning {
+	return e.caseFold.Warnings()
+}
+
+// EvalContext evaluates node in env, stopping with an *object.LimitError
+// when ctx is done or the run goes past the evaluator's limits.
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	defer e.start(ctx)()
+	e.envs = []*object.Environment{env}
+	return e.Eval(node, env)
+}
+
+// start begins a run that ends when ctx is done or the evaluator's limits
+// are reached, returning the func that ends it. Every Eval until then
+// counts towards the same limits.
+func (e *Evaluator) start(ctx context.Context) (stop func()) {
+	cancel := func() {}
+	if e.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+	}
+
+	e.steps = object.NewSteps(ctx, e.stepLimit)
+	e.memory = object.NewMemory(e.memoryLimit, e.inUse)
+	e.envs = nil
+	e.running = true
+	return func() {
+		e.running = false
+		cancel()
+	}
+}
+
+// Eval evaluates node in env. Errors are located at the innermost node
+// they came out of.
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if !e.running {
+		return e.EvalContext(context.Background(), node, env)
+	}
+	if err := e.steps.Take(); err != nil {
+		return err
+	}
+
+	result := e.eval(node, env)
+	if err, ok := result.(*object.Error); ok {
+		err.Locate(node.Pos())
+	}
+	return result
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return object.Thrown(val)
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Pattern == nil {
+			env.Set(node.Name.Value, val)
+		} else if err := bindPattern(node.Pattern, val, env); err != nil {
+			return err
+		}
 
 		// Expressions
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		if node.Operator == "&&" || node.Operator == "||" || node.Operator == "??" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		if e.caseFold != nil {
+			e.caseFold.Check(node.Token.Pos, node.Operator, left, right)
+		}
+		return e.allocate(evalInfixExpression(node.Operator, left, right))
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		if node.Optional && isNull(left) {
+			return NULL
+		}
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
+		if left.Type() == object.STRING_OBJ {
+			return e.allocate(evalIndexExpression(left, index))
+		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(node, env)
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 	case *ast.Boolean:
-		return nativeBooleanToBooleanObject(node.Value)
+		return object.NativeBool(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return e.evalInterpolatedString(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 
-		return &object.Array{Elements: elements}
+		return e.allocate(&object.Array{Elements: elements})
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 	case *ast.FunctionLiteral:
+		e.findTailCalls(node)
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body, Name: node.Name}
+	case *ast.MacroLiteral:
+		return newError(object.PlainError, "macro literals must be bound with a top-level let")
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError(object.TypeError, "wrong number of arguments to `quote`. got=%d, want=1", len(node.Arguments))
+			}
+			return e.quote(node.Arguments[0], env)
+		}
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		if node.Optional && isNull(function) {
+			return NULL
+		}
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFuction(function, args)
+		if fn, ok := function.(*object.Function); ok && e.tailCalls[node] {
+			return &tailCall{fn: fn, args: args}
+		}
+		return e.applyFuction(function, args, node.Pos())
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result.Value
-		case *object.Error:
+		if returnValue, ok := result.(*object.ReturnValue); ok {
+			return returnValue.Value
+		}
+		if isError(result) {
 			return result
 		}
 	}
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result != nil {
 			switch result.Type() {
@@ -139,24 +328,138 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalTildePrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
+	case operator == "==":
+		return object.NativeBool(object.Equals(left, right))
+	case operator == "!=":
+		return object.NativeBool(!object.Equals(left, right))
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
-		return evalBooleanInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalLogicalExpression short-circuits `&&`, `||` and `??`. The result is
+// the operand that decided the outcome rather than a coerced boolean, so
+// `0 || "x"` yields 0 and `null || "x"` yields "x". `??` only falls back
+// to the right side for null, so `false ?? "x"` yields false.
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	switch node.Operator {
+	case "&&":
+		if !object.IsTruthy(left) {
+			return left
+		}
+	case "||":
+		if object.IsTruthy(left) {
+			return left
+		}
+	case "??":
+		if !isNull(left) {
+			return left
+		}
+	}
+
+	return e.Eval(node.Right, env)
+}
+
+// evalMatchExpression evaluates the body of the first arm that matches,
+// with the arm's bindings set in env. It gives null if no arm matches.
+func (e *Evaluator) evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := e.Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		values, ok := object.Match(arm.Pattern, subject)
+		if !ok {
+			continue
+		}
+		// The bindings, and whatever the body defines, are only seen
+		// by the arm
+		armEnv := object.EncaseEnvironment(env)
+		for i, ident := range ast.PatternIdentifiers(arm.Pattern) {
+			armEnv.Set(ident.Value, values[i])
+		}
+		e.envs = append(e.envs, armEnv)
+		defer func() { e.envs = e.envs[:len(e.envs)-1] }()
+
+		if arm.Guard != nil {
+			guard := e.Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !object.IsTruthy(guard) {
+				continue
+			}
+		}
+		if result := e.Eval(arm.Body, armEnv); result != nil {
+			return result
+		}
+		// A block body ending in a let
+		return NULL
 	}
+
+	return NULL
+}
+
+// bindPattern sets the variables of a destructuring let, returning an
+// error if value doesn't have the shape of the pattern.
+func bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	var targets []ast.Pattern
+	var rest *ast.Identifier
+	var values []object.Object
+	var err *object.Error
+
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil
+	case *ast.Identifier:
+		env.Set(pattern.Value, value)
+		return nil
+	case *ast.ArrayPattern:
+		targets, rest = pattern.Elements, pattern.Rest
+		values, err = object.DestructureArray(value, len(targets), rest != nil)
+	case *ast.HashPattern:
+		keys := make([]string, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			keys[i] = pair.Key
+			targets = append(targets, pair.Value)
+		}
+		rest = pattern.Rest
+		values, err = object.DestructureHash(value, keys, rest != nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, target := range targets {
+		if err := bindPattern(target, values[i], env); err != nil {
+			return err
+		}
+	}
+	if rest != nil {
+		env.Set(rest.Value, values[len(targets)])
+	}
+	return nil
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
@@ -171,28 +474,49 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "division by zero: %d / %d", leftVal, rightVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		// Like division, modulo truncates towards zero, so the result
+		// takes the sign of the left operand: -7 % 3 == -1
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "division by zero: %d %% %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 {
+			return newError(object.ArithmeticError, "negative exponent: %d ** %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: object.IntegerPow(leftVal, rightVal)}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<":
+		if rightVal < 0 {
+			return newError(object.ArithmeticError, "negative shift count: %d << %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal << rightVal}
+	case ">>":
+		// Arithmetic shift, negative numbers stay negative: -8 >> 1 == -4
+		if rightVal < 0 {
+			return newError(object.ArithmeticError, "negative shift count: %d >> %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	case "<":
-		return nativeBooleanToBooleanObject(leftVal < rightVal)
+		return object.NativeBool(leftVal < rightVal)
 	case ">":
-		return nativeBooleanToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBooleanToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBooleanToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evalBooleanInfixExpression(operator string, left, right object.Object) object.Object {
-	switch operator {
-	case "==":
-		return nativeBooleanToBooleanObject(left == right)
-	case "!=":
-		return nativeBooleanToBooleanObject(left != right)
+		return object.NativeBool(leftVal > rightVal)
+	case "<=":
+		return object.NativeBool(leftVal <= rightVal)
+	case ">=":
+		return object.NativeBool(leftVal >= rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -202,12 +526,16 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	switch operator {
 	case "+":
 		return &object.String{Value: leftVal + rightVal}
-	case "==":
-		return nativeBooleanToBooleanObject(strings.EqualFold(leftVal, rightVal))
-	case "!=":
-		return nativeBooleanToBooleanObject(!strings.EqualFold(leftVal, rightVal))
+	case "<":
+		return object.NativeBool(leftVal < rightVal)
+	case ">":
+		return object.NativeBool(leftVal > rightVal)
+	case "<=":
+		return object.NativeBool(leftVal <= rightVal)
+	case ">=":
+		return object.NativeBool(leftVal >= rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -215,92 +543,179 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
 	}
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	idx, ok := object.ElementIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
 
-	if idx < 0 || idx > max {
+	if !ok {
 		return NULL
 	}
 
 	return arrayObject.Elements[idx]
 }
 
+// evalStringIndexExpression indexes by character rather than by byte
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx, ok := object.ElementIndex(index.(*object.Integer).Value, len(runes))
+
+	if !ok {
+		return NULL
+	}
+
+	return &object.String{Value: string(runes[idx])}
+}
+
+func (e *Evaluator) evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if node.Optional && isNull(left) {
+		return NULL
+	}
+
+	var bounds [2]*int64
+	for i, boundNode := range []ast.Expression{node.Low, node.High} {
+		if boundNode == nil {
+			continue
+		}
+		bound := e.Eval(boundNode, env)
+		if isError(bound) {
+			return bound
+		}
+		integer, ok := bound.(*object.Integer)
+		if !ok {
+			return newError(object.TypeError, "slice bounds must be INTEGER, got %s", bound.Type())
+		}
+		bounds[i] = &integer.Value
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		start, end := object.SliceBounds(bounds[0], bounds[1], len(left.Elements))
+		elements := make([]object.Object, end-start)
+		copy(elements, left.Elements[start:end])
+		return e.allocate(&object.Array{Elements: elements})
+	case *object.String:
+		runes := []rune(left.Value)
+		start, end := object.SliceBounds(bounds[0], bounds[1], len(runes))
+		return e.allocate(&object.String{Value: string(runes[start:end])})
+	default:
+		return newError(object.TypeError, "slice operator not supported: %s", left.Type())
+	}
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+	key, ok := object.HashKeyOf(index)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(object.TypeError, "unusable as hash key: %s", index.Type())
 	}
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.GetHashed(key, index)
 
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
-	}
+	return object.NativeBool(!object.IsTruthy(right))
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TypeError, "unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
 	return &object.Integer{Value: -value}
 }
 
+func evalTildePrefixOperatorExpression(right object.Object) object.Object {
+	if right.Type() != object.INTEGER_OBJ {
+		return newError(object.TypeError, "unknown operator: ~%s", right.Type())
+	}
+
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: ^value}
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NameError, "identifier not found: %s", node.Value)
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+	if object.IsTruthy(condition) {
+		return e.Eval(ie.Consequence, env)
 	}
 	if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	}
 	return NULL
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+// evalTryExpression runs the catch block when the try block gives an
+// error, with the caught error bound like a let. The finally block runs
+// last in any case, and only its errors and returns replace the result.
+func (e *Evaluator) evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.Eval(node.Block, env)
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		caught := err.Caught()
+		if err.Value == nil {
+			// Only the hash a runtime error is caught as is new
+			if caught = e.allocate(caught); isError(caught) {
+				return caught
+			}
+		}
+		env.Set(node.Parameter.Value, caught)
+		result = e.Eval(node.Catch, env)
+	}
+
+	// A limit stops the program, the finally block doesn't get to run
+	if _, stopped := result.(*object.LimitError); !stopped && node.Finally != nil {
+		finally := e.Eval(node.Finally, env)
+		if finally != nil {
+			switch finally.Type() {
+			case object.ERROR_OBJ, object.RETURN_VALUE_OBJ:
+				return finally
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	result := []object.Object{}
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -310,55 +725,47 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+func (e *Evaluator) evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	values := e.evalExpressions(node.Expressions, env)
+	if len(values) == 1 && isError(values[0]) {
+		return values[0]
+	}
+
+	return e.allocate(object.Interpolate(node.Strings, values))
+}
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := e.Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
+		hashed, ok := object.HashKeyOf(key)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError(object.TypeError, "unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := e.Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.SetHashed(hashed, key, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
-}
-
-func nativeBooleanToBooleanObject(val bool) object.Object {
-	if val {
-		return TRUE
-	}
-	return FALSE
+	return e.allocate(hash)
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
-	}
+func newError(kind string, format string, a ...interface{}) *object.Error {
+	return object.NewError(kind, format, a...)
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func isNull(obj object.Object) bool {
+	_, ok := obj.(*object.Null)
+	return ok
 }
 
 func isError(obj object.Object) bool {
@@ -368,18 +775,98 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func applyFuction(fn object.Object, args []object.Object) object.Object {
+// applyFuction calls fn from the position call, which is where errors
+// coming out of fn continue from.
+func (e *Evaluator) applyFuction(fn object.Object, args []object.Object, call token.Position) object.Object {
 	switch fun := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fun, args)
-		evaluated := Eval(fun.Body, extendedEnv)
+		if e.callDepth >= e.maxDepth() {
+			return object.NewRecursionError()
+		}
+		e.callDepth++
+		defer func() { e.callDepth-- }()
+
+		e.envs = append(e.envs, nil)
+		defer func() { e.envs = e.envs[:len(e.envs)-1] }()
 
-		return unwrapReturnValue(evaluated)
+		// Calls in tail position come back as a tailCall, made here in
+		// place of fun so that they don't go any deeper
+		for {
+			if len(args) != len(fun.Parameters) {
+				return newError(object.TypeError, "wrong number of arguments: want=%d, got=%d", len(fun.Parameters), len(args))
+			}
+			extendedEnv := extendFunctionEnv(fun, args)
+			e.envs[len(e.envs)-1] = extendedEnv
+			evaluated := unwrapReturnValue(e.Eval(fun.Body, extendedEnv))
+			if next, ok := evaluated.(*tailCall); ok {
+				fun, args = next.fn, next.args
+				continue
+			}
+			if err, ok := evaluated.(*object.Error); ok {
+				err.Unwind(fun.Name, call)
+			}
+			return evaluated
+		}
 	case *object.Builtin:
-		return fun.Fn(args...)
+		result := fun.Fn(args...)
+		if result == nil {
+			return NULL
+		}
+		if fun.ReturnsArgument {
+			return result
+		}
+		return e.allocate(result)
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(object.TypeError, "not a function: %s", fn.Type())
+	}
+}
+
+// inUse measures the memory the values in the environments being run
+// take.
+func (e *Evaluator) inUse() int64 {
+	return object.InUse(e.envs)
+}
+
+// allocate counts obj, a value that was just built, against the memory
+// limit. It returns obj, or the error to stop with when it's over.
+func (e *Evaluator) allocate(obj object.Object) object.Object {
+	if err := e.memory.Allocate(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// tailCall is what a call in tail position evaluates to: the call still
+// to be made, which applyFuction makes once the function it's in returns.
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call to " + tc.fn.Inspect() }
+
+// findTailCalls records the calls in tail position of fn, the first time
+// it's evaluated.
+func (e *Evaluator) findTailCalls(fn *ast.FunctionLiteral) {
+	if e.analysed[fn] {
+		return
+	}
+	if e.analysed == nil {
+		e.analysed = map[*ast.FunctionLiteral]bool{}
+		e.tailCalls = map[*ast.CallExpression]bool{}
+	}
+	e.analysed[fn] = true
+	for call := range ast.TailCalls(fn) {
+		e.tailCalls[call] = true
+	}
+}
+
+func (e *Evaluator) maxDepth() int {
+	if e.maxCallDepth > 0 {
+		return e.maxCallDepth
 	}
+	return DefaultMaxCallDepth
 }
 
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
@@ -1,7 +1,12 @@
 package evalutator
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"alde.nu/mint/lexer"
 	"alde.nu/mint/object"
@@ -23,6 +28,7 @@ func Test_EvalIntegerExpression(t *testing.T) {
 		{"10*5", 50},
 		{"5+5+5+5-10", 10},
 		{"2*2*2*2*2", 32},
+		{"0xFF + 0o10 + 0b11 + 1_000", 1266},
 		{"-50 + 100 + -50", 0},
 		{"5 + 2 * 10", 25},
 		{"5 * 2 + 10", 20},
@@ -31,6 +37,29 @@ func Test_EvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 - 10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"-7 / 2", -3},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"0 ** 0", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"~-1", 0},
+		{"1 << 4", 16},
+		{"-1 << 3", -8},
+		{"256 >> 4", 16},
+		{"-8 >> 1", -4},
+		{"-1 >> 63", -1},
+		{"1 << 64", 0},
+		{"1 + 2 << 1", 6},
+		{"1 | 2 ^ 3 & 4", 3},
 	}
 
 	for _, tt := range testData {
@@ -62,6 +91,136 @@ func Test_EvalBooleanExpression(t *testing.T) {
 		{"(1 > 2) == true", false},
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"-3 >= -2", false},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"a" > "b"`, false},
+		{`"abc" > "abd"`, false},
+		{`"ab" < "abc"`, true},
+		{`"a" <= "a"`, true},
+		{`"b" >= "a"`, true},
+		{`"B" < "a"`, true},
+		{`"admin" == "admin"`, true},
+		{`"Admin" == "admin"`, false},
+		{`"Admin" != "admin"`, true},
+		{`"admin" != "admin"`, false},
+		{`"straße" == "STRASSE"`, false},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func Test_LogicalOperators(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 && 2", 2},
+		{"1 || 2", 1},
+		{"false || 5", 5},
+		{"if (false) { 1 } || 7", 7},
+		{"if (false) { 1 } && 7", nil},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false && foobar", false},
+		{"true || foobar", true},
+		{"let called = fn() { undefinedFn() }; false && called()", false},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func Test_NullAndOptionalChaining(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"null == null", true},
+		{"null != 1", true},
+		{"!null", true},
+		{"null ?? 5", 5},
+		{"1 ?? 5", 1},
+		{"false ?? 5", false},
+		{"null ?? null", nil},
+		{"null ?? null ?? 3", 3},
+		{"1 ?? foobar", 1},
+		{`let cfg = {"db": {"host": "db1"}}; cfg?.["db"]?.["host"] == "db1"`, true},
+		{`let cfg = {}; cfg?.["db"]?.["host"] ?? 5`, 5},
+		{`let cfg = null; cfg?.["db"]?.["host"] ?? 5`, 5},
+		{`let cfg = null; cfg?.[foobar]`, nil},
+		{`[1, 2]?.[1]`, 2},
+		{"let f = fn(x) { x * 2 }; f?.(2)", 4},
+		{"let f = null; f?.(foobar)", nil},
+		{"let f = null; f?.(1) ?? 7", 7},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func Test_StructuralEquality(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{"[[1], [2]] == [[1], [2]]", true},
+		{`["a", true] == ["a", true]`, true},
+		{`["a"] == ["A"]`, false},
+		{"[] == []", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{"{} != {}", false},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+		{"let make = fn() { fn() { 1 } }; make() == make()", false},
+		{"len == len", true},
+		{"len == first", false},
+		{"1 == true", false},
+		{`1 != "1"`, true},
+		{"[1] == 1", false},
+		{"if (false) { 1 } == if (false) { 2 }", true},
+		{"fn() {}() == 1", false},
+		{"fn() {}() == null", true},
 	}
 
 	for _, tt := range testData {
@@ -168,8 +327,24 @@ func Test_ErrorHandling(t *testing.T) {
 			return 1;
 		}`, "unknown operator: BOOLEAN + BOOLEAN"},
 		{"foobar", "identifier not found: foobar"},
+		{"true && foobar", "identifier not found: foobar"},
+		{"foobar || true", "identifier not found: foobar"},
 		{`"hello" - "world"`, "unknown operator: STRING - STRING"},
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"1 % 0", "division by zero: 1 % 0"},
+		{"2 ** -1", "negative exponent: 2 ** -1"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"1 >> -1", "negative shift count: 1 >> -1"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{`null["a"]`, "index operator not supported: NULL"},
+		{"let f = null; f()", "not a function: NULL"},
+		{"let f = fn(x) { x }; f()", "wrong number of arguments: want=1, got=0"},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"true <= false", "unknown operator: BOOLEAN <= BOOLEAN"},
+		{`"a" % "b"`, "unknown operator: STRING % STRING"},
 		{`{"name": "monkey"}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+		{`{[1, fn(x) { x }]: 1}`, "unusable as hash key: ARRAY"},
+		{`{{"f": fn(x) { x }}: 1}`, "unusable as hash key: HASH"},
 	}
 
 	for _, tt := range testData {
@@ -186,6 +361,277 @@ func Test_ErrorHandling(t *testing.T) {
 	}
 }
 
+func Test_TryExpression(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { e }`, "boom"},
+		{`try { 1 / 0 } catch (e) { "${e["kind"]}: ${e["message"]}" }`, "ArithmeticError: division by zero: 1 / 0"},
+		{`try { foo } catch (e) { e["kind"] }`, "NameError"},
+		{`try { let [a] = 1 } catch (e) { e["kind"] }`, "PatternError"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { throw 1 } catch (e) { e + 1 }`, 2},
+		{`try { try { throw [1, 2] } catch (e) { throw e } } catch (e) { e[1] }`, 2},
+		{`try { throw {"code": 2} } catch (e) { "${e}" }`, "{code: 2}"},
+		{`try { try { 1 / 0 } catch (e) { throw e } } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`try { throw {"code": 2} } catch (e) { "${type(e["message"])} ${e["code"]}" }`, "NULL 2"},
+		{`try { len(1) } catch (e) { e["kind"] }`, "TypeError"},
+		{`let f = fn(x) { x }; try { f() } catch (e) { "${e["kind"]}: ${e["message"]}" }`, "TypeError: wrong number of arguments: want=1, got=0"},
+		{`try { [1][0:"a"] } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { 1 << -1 } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`try { throw {"kind": "ValueError", "message": "bad", "code": 7} } catch (e) { "${e["kind"]} ${e["message"]} ${e["code"]}" }`, "ValueError bad 7"},
+		{`let inner = fn() { 1 / 0 }; let outer = fn() { inner(); 1 }; try { outer() } catch (e) { "${e["stack"]}" }`, "[inner (1:22), outer (1:53)]"},
+		{`try { fn() { [][0] + 1 }() } catch (e) { "${e["stack"]}" }`, "[<anonymous> (1:20)]"},
+		{`let f = fn(x) { 10 + try { x / 0 } catch (e) { x } }; f(5)`, 15},
+		{`let f = fn() { throw "x" }; let g = fn() { try { f() } catch (e) { 1 } }; g() + g()`, 2},
+		{`try { 1 } finally { 2 }`, 1},
+		{`let x = 1; try { x } finally { let x = 2 }; x`, 2},
+		{`let x = 0; let r = try { throw 1 } catch (e) { 10 } finally { let x = 5 }; r + x`, 15},
+		{`let x = 0; let r = try { try { throw "in" } finally { let x = 1 } } catch (e) { e }; "${r} ${x}"`, "in 1"},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (e) { e }`, "a"},
+		{`let x = 0; let r = try { try { throw "a" } catch (e) { throw "b" } finally { let x = 1 } } catch (e) { e }; "${r} ${x}"`, "b 1"},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`let f = fn() { try { return 1 } finally { throw "f" } }; try { f() } catch (e) { e }`, "f"},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } }; let g = fn() { f(); throw "g" }; try { g() } catch (e) { e }`, "g"},
+		{`let count = fn(n) { if (n == 0) { return 0 }; try { count(n - 1) + 1 } catch (e) { -1 } }; count(20)`, 20},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func Test_UncaughtThrow(t *testing.T) {
+	testData := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`throw "boom"`, "boom"},
+		{`throw 42`, "42"},
+		{`throw {"message": "m", "kind": "K"}`, "m"},
+		{`try { 1 } finally { throw "f" }`, "f"},
+		{`try { throw "a" } catch (e) { throw "b" }`, "b"},
+		{`let f = fn() { throw "x" }; f(); 1`, "x"},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+
+		if !ok {
+			t.Errorf("no error object returned. got %T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, expected %q, got %q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func Test_ErrorTrace(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"let inner = fn(x) {\n\tx / 0\n};\nlet outer = fn() { inner(1); 1 };\nouter();", "inner 2:4, outer 4:25, <main> 5:6"},
+		{"let inner = fn(x) {\n\tx / 0\n};\nlet outer = fn() { inner(1) };\nouter();", "inner 2:4, <main> 5:6"},
+		{"let f = fn() { len(1) };\n[f][0]()", "f 1:19, <main> 2:7"},
+		{"fn() { throw \"x\" }()", "<anonymous> 1:8, <main> 1:19"},
+		{"let f = fn() { 1 + true };\ntry { f() } catch (e) { throw e }", "f 1:18, <main> 2:25"},
+		{"let g = fn() { 1 + true };\nlet f = fn() { try { g() } finally { 1 } };\nf()", "g 1:18, f 2:23, <main> 3:2"},
+		{"let f = fn() { try { 1 + true } catch (e) { 1 / 0 } finally { 1 } };\nf()", "f 1:47, <main> 2:2"},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got %T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if trace := formatTrace(errObj.Trace()); trace != tt.expected {
+			t.Errorf("wrong trace for %q. want=%q, got=%q", tt.input, tt.expected, trace)
+		}
+	}
+}
+
+func Test_MaxCallDepth(t *testing.T) {
+	countdown := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };"
+	testData := []struct {
+		input    string
+		depth    int
+		expected interface{}
+	}{
+		{countdown + "f(9)", 10, 9},
+		{countdown + "f(10)", 10, object.RecursionMessage},
+		{"let f = fn(n) { 1 + f(n + 1) }; try { f(0) } catch (e) { e[\"kind\"] }", 10, "RecursionError"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", 0, object.RecursionMessage},
+	}
+
+	for _, tt := range testData {
+		program := parser.Create(lexer.Create(tt.input)).ParseProgram()
+		evaluated := New(WithMaxCallDepth(tt.depth)).Eval(program, object.CreateEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+				if len(errObj.Stack) > object.MaxStackFrames {
+					t.Errorf("stack not truncated. got %d frames", len(errObj.Stack))
+				}
+				continue
+			}
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func Test_TailCalls(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(n) { if (n == 0) { \"done\" } else { f(n - 1) } }; f(1000)", "done"},
+		{"let f = fn(n) { if (n > 0) { return f(n - 1) }; n }; f(1000)", 0},
+		{"let f = fn(n) { match (n) { 0 => \"done\", _ => f(n - 1) } }; f(1000)", "done"},
+		{"let ping = fn(n, other) { if (n == 0) { \"ping\" } else { other(n - 1, ping) } }; let pong = fn(n, other) { if (n == 0) { \"pong\" } else { other(n - 1, pong) } }; ping(1001, pong)", "pong"},
+		{"let sum = fn(arr, acc) { if (len(arr) == 0) { acc } else { sum(rest(arr), acc + first(arr)) } }; sum([1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12], 0)", 78},
+		{"let f = fn(a) { len(a) }; f([1, 2])", 2},
+	}
+
+	for _, tt := range testData {
+		program := parser.Create(lexer.Create(tt.input)).ParseProgram()
+		evaluated := New(WithMaxCallDepth(10)).Eval(program, object.CreateEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func Test_StepLimit(t *testing.T) {
+	loop := "let f = fn() { f() };"
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", 3},
+		{loop + "f()", "step limit of 100 exceeded"},
+		{loop + "try { f() } catch (e) { 1 }", "step limit of 100 exceeded"},
+		{loop + "fn() { try { f() } finally { return 1 } }()", "step limit of 100 exceeded"},
+		{loop + "f(); 1", "step limit of 100 exceeded"},
+		{loop + "let r = try { f() } catch (e) { 0 }; r", "step limit of 100 exceeded"},
+	}
+
+	for _, tt := range testData {
+		program := parser.Create(lexer.Create(tt.input)).ParseProgram()
+		evaluated := New(WithStepLimit(100)).Eval(program, object.CreateEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			limit, ok := evaluated.(*object.LimitError)
+			if !ok {
+				t.Errorf("no limit error returned for %q. got %T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if limit.Message != expected {
+				t.Errorf("wrong message for %q. want=%q, got=%q", tt.input, expected, limit.Message)
+			}
+		}
+	}
+}
+
+func Test_EvalContext(t *testing.T) {
+	program := parser.Create(lexer.Create("let f = fn() { f() }; f(); 1")).ParseProgram()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	evaluated := EvalContext(cancelled, program, object.CreateEnvironment())
+	if err, ok := evaluated.(error); !ok || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a limit error for context.Canceled, got %T (%+v)", evaluated, evaluated)
+	}
+
+	evaluated = New(WithTimeout(10*time.Millisecond)).Eval(program, object.CreateEnvironment())
+	if err, ok := evaluated.(error); !ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a limit error for context.DeadlineExceeded, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func Test_MemoryLimit(t *testing.T) {
+	grow := "let grow = fn(arr, n) { if (n == 0) { len(arr) } else { grow(push(arr, n), n - 1) } };"
+	// Every array holds the one before it, so they all stay in use
+	keep := "let keep = fn(arr) { keep(push(arr, arr)) };"
+	testData := []struct {
+		input    string
+		limit    int64
+		expected interface{}
+	}{
+		{grow + "grow([], 1000)", 0, 1000},
+		// Only the last array is in use, the ones before it are garbage
+		{grow + "grow([], 1000)", 100000, 1000},
+		{keep + "keep([1])", 100000, "memory limit of 100000 bytes exceeded"},
+		{keep + "try { keep([1]) } catch (e) { 0 }", 100000, "memory limit of 100000 bytes exceeded"},
+		{keep + "keep([1]); 1", 100000, "memory limit of 100000 bytes exceeded"},
+		{keep + "let r = try { keep([1]) } catch (e) { 0 }; r", 100000, "memory limit of 100000 bytes exceeded"},
+		{"let s = fn(str, n) { if (n == 0) { str } else { s(str + str, n - 1) } }; len(s(\"ab\", 30))", 1 << 20, "memory limit of 1048576 bytes exceeded"},
+	}
+
+	for _, tt := range testData {
+		program := parser.Create(lexer.Create(tt.input)).ParseProgram()
+		evaluated := New(WithMemoryLimit(tt.limit)).Eval(program, object.CreateEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			limit, ok := evaluated.(*object.LimitError)
+			if !ok {
+				t.Errorf("no limit error returned for %q. got %T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if limit.Message != expected {
+				t.Errorf("wrong message for %q. want=%q, got=%q", tt.input, expected, limit.Message)
+			}
+		}
+	}
+}
+
+func Test_MemoryStats(t *testing.T) {
+	program := parser.Create(lexer.Create(`let a = [1, 2, 3]; let s = "ab" + "c"; first([a]); len(s)`)).ParseProgram()
+
+	e := New()
+	e.Eval(program, object.CreateEnvironment())
+	expected := object.MemoryStats{Allocations: 3, AllocatedBytes: 80 + 27 + 48, PeakBytes: 80 + 27 + 48}
+	if stats := e.MemoryStats(); stats != expected {
+		t.Errorf("wrong stats. want=%+v, got=%+v", expected, stats)
+	}
+}
+
+func formatTrace(trace []object.StackFrame) string {
+	frames := []string{}
+	for _, frame := range trace {
+		frames = append(frames, fmt.Sprintf("%s %s", frame.Function, frame.Pos))
+	}
+	return strings.Join(frames, ", ")
+}
+
 func Test_LetStatement(t *testing.T) {
 	testData := []struct {
 		input    string
@@ -210,6 +656,123 @@ func Test_LetStatement(t *testing.T) {
 	}
 }
 
+func Test_DestructuringLetStatement(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = [1, 2]; a + b", "3"},
+		{"let [a, ...rest] = [1, 2, 3]; rest", "[2, 3]"},
+		{"let [a, ...rest] = [1]; rest", "[]"},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", "6"},
+		{`let {name, age: years} = {"name": "ann", "age": 30}; [name, years]`, "[ann, 30]"},
+		{`let {"a b": x} = {"a b": 1}; x`, "1"},
+		{`let {a, ...others} = {"c": 3, "a": 1, "b": 2}; others`, "{c: 3, b: 2}"},
+		{`let {pos: [x, y]} = {"pos": [1, 2]}; x * 10 + y`, "12"},
+		{"let f = fn(xs) { let [h, ...t] = xs; h + len(t) }; f([5, 6, 7])", "7"},
+		{"let [a, b] = [1]; a", "array pattern needs 2 elements, got 1"},
+		{"let [a] = [1, 2]; a", "array pattern needs 1 elements, got 2"},
+		{"let [a, b, ...c] = [1]; a", "array pattern needs at least 2 elements, got 1"},
+		{"let [a] = 1; a", "cannot destructure INTEGER with an array pattern"},
+		{`let {a} = {"b": 1}; a`, `hash pattern key "a" not found`},
+		{"let {a} = [1]; a", "cannot destructure ARRAY with a hash pattern"},
+		{"let [_, b] = [1, 2]; b", "2"},
+		{`let {a: [b]} = {"a": 1}; b`, "cannot destructure INTEGER with an array pattern"},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. want=%q, got=%q", tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s wrong. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func Test_MatchExpression(t *testing.T) {
+	describe := `let describe = fn(x) {
+		match (x) {
+			0 => "zero",
+			-1 => "minus one",
+			true => "yes",
+			null => "nothing",
+			"hi" => "greeting",
+			n if type(n) == "INTEGER" && n > 100 => "big",
+			[] => "empty",
+			[a] => "one " + type(a),
+			[1, ...rest] => "starts with 1, then " + type(rest),
+			{"kind": "point", x, y} => "point",
+			{"kind": k, ...others} => k + " with " + type(others),
+			_ => "other",
+		}
+	};`
+
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{describe + "describe(0)", "zero"},
+		{describe + "describe(-1)", "minus one"},
+		{describe + "describe(true)", "yes"},
+		{describe + "describe(false)", "other"},
+		{describe + "describe(null)", "nothing"},
+		{describe + `describe("hi")`, "greeting"},
+		{describe + `describe("Hi")`, "other"},
+		{describe + "describe(101)", "big"},
+		{describe + "describe(100)", "other"},
+		{describe + "describe([])", "empty"},
+		{describe + `describe(["a"])`, "one STRING"},
+		{describe + "describe([1, 2, 3])", "starts with 1, then ARRAY"},
+		{describe + "describe([2, 2, 3])", "other"},
+		{describe + `describe({"kind": "point", "x": 1, "y": 2})`, "point"},
+		{describe + `describe({"kind": "point", "x": 1})`, "point with HASH"},
+		{describe + `describe({"x": 1})`, "other"},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c, _ => 0 }", 6},
+		{`match ({"a": {"b": 5}}) { {"a": {"b": v}} => v }`, 5},
+		{"let x = match (5) { n => n * 2 }; x", 10},
+		{"match (5) { 1 => 1 }", nil},
+		{"match (5) { n if n > 10 => 1, n if n > 1 => 2, _ => 3 }", 2},
+		{"match (foobar) { _ => 1 }", "identifier not found: foobar"},
+		{"match (1) { n if foobar => 1 }", "identifier not found: foobar"},
+		{"let x = 10; match (3) { x => x }; x", 10},
+		{"let x = 10; match (3) { x => x }", 3},
+		{"let f = fn() { let x = 10; match (3) { x => x }; x }; f()", 10},
+		{"let x = 10; match ([1, 2]) { [x, y] if x < y => x + y, _ => 0 } + x", 13},
+		{"match (1) { 1 => { let a = 2; a + 1 }, _ => 0 }", 3},
+		{"let a = 5; match (1) { 1 => { let a = 2; a }, _ => 0 }; a", 5},
+		{"match ([1, 2]) { [a, b] if a < b => { let s = a + b; s * 2 }, _ => 0 }", 6},
+		{`let h = match (1) { 1 => {"a": 7}, _ => {} }; h["a"]`, 7},
+		{"let g = match (4) { n => fn() { n } }; g()", 4},
+		{"let f = fn(x) { match (x) { n => fn() { n + x } } }; f(2)()", 4},
+		{"match (1) { n => n }; n", "identifier not found: n"},
+		{"match (1) { 1 => { let a = 2 } }", nil},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. want=%q, got=%q", expected, errObj.Message)
+				}
+				continue
+			}
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func Test_FunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 	evaluated := testEval(input)
@@ -272,6 +835,42 @@ func Test_StringConcatenation(t *testing.T) {
 	}
 }
 
+func Test_StringInterpolation(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let name = "mint"; let items = [1, 2]; "Hello ${name}, you have ${len(items)} items"`, "Hello mint, you have 2 items"},
+		{`"${1 + 2}${true}${null}"`, "3truenull"},
+		{`"list: ${[1, "a"]}"`, "list: [1, a]"},
+		{`let x = "in"; "out ${ "in ${x}" } out"`, "out in in out"},
+		{`"\\${1}"`, "\\1"},
+		{`"\${1}"`, "${1}"},
+		{`"${-true}"`, "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong result for %s. want=%q, got error %q", tt.input, expected, errObj.Message)
+				}
+				continue
+			}
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String, got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, expected, str.Value)
+			}
+		}
+	}
+}
+
 func Test_BuiltInFunctions(t *testing.T) {
 	testData := []struct {
 		input    string
@@ -280,6 +879,11 @@ func Test_BuiltInFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		// Changed: len counted bytes before indexing went by character,
+		// when these were 6, 6 and 8
+		{`len("héllo")`, 5},
+		{`len("日本")`, 2},
+		{`len("🙂🙂")`, 2},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments to `len`. got=2, want=1"},
 	}
@@ -303,6 +907,101 @@ func Test_BuiltInFunctions(t *testing.T) {
 	}
 }
 
+func Test_HashOrder(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{`{"c": 1, "a": 2, "b": 3}`, "{c: 1, a: 2, b: 3}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+		{`keys({"c": 1, "a": 2, "b": 3})`, "[c, a, b]"},
+		{`values({"c": 1, "a": 2, "b": 3})`, "[1, 2, 3]"},
+		{`keys({})`, "[]"},
+		{`keys([])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`values({}, {})`, "wrong number of arguments to `values`. got=2, want=1"},
+	}
+
+	for _, tt := range testData {
+		// Run each case a few times, map iteration order would show up here
+		for i := 0; i < 5; i++ {
+			evaluated := testEval(tt.input)
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != tt.expected {
+					t.Errorf("wrong error message. want=%q, got=%q", tt.expected, errObj.Message)
+				}
+				break
+			}
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("%s wrong. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+				break
+			}
+		}
+	}
+}
+
+func Test_CaseFoldingBuiltins(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`equal_fold("Admin", "admin")`, true},
+		{`equal_fold("admin", "root")`, false},
+		{`lower("MiNt")`, "mint"},
+		{`upper("MiNt")`, "MINT"},
+		{`lower("Admin") == "admin"`, true},
+		{`equal_fold("a")`, "wrong number of arguments to `equal_fold`. got=1, want=2"},
+		{`equal_fold("a", 1)`, "argument to `equal_fold` must be STRING, got INTEGER"},
+		{`lower(1)`, "argument to `lower` must be STRING, got INTEGER"},
+		{`upper("a", "b")`, "wrong number of arguments to `upper`. got=2, want=1"},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. \nexpected\t%q\nactual\t\t%q.", expected, errObj.Message)
+				}
+				continue
+			}
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func Test_CaseFoldWarnings(t *testing.T) {
+	input := `let check = fn(role) { role == "admin" };
+check("Admin");
+check("ADMIN");
+check("admin");
+"x" != "X";
+"a" == "b";
+`
+	l := lexer.Create(input)
+	p := parser.Create(l)
+	e := New(WithCaseFoldWarnings())
+	e.Eval(p.ParseProgram(), object.CreateEnvironment())
+
+	expected := []string{
+		`1:29: "Admin" == "admin" is false, but was true when string equality ignored case; use equal_fold() to keep the old behaviour`,
+		`5:5: "x" != "X" is true, but was false when string equality ignored case; use equal_fold() to keep the old behaviour`,
+	}
+
+	warnings := e.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("wrong number of warnings. want=%d, got=%d (%v)", len(expected), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.String() != expected[i] {
+			t.Errorf("wrong warning.\nexpected\t%q\nactual\t\t%q", expected[i], w.String())
+		}
+	}
+}
+
 func Test_TypeArgument(t *testing.T) {
 	testData := []struct {
 		input    string
@@ -358,7 +1057,9 @@ func Test_ArrayIndexExpressions(t *testing.T) {
 		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
 		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
 		{"[1, 2, 3][3]", nil},
-		{"[1, 2, 3][-1]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
 	}
 
 	for _, tt := range testData {
@@ -372,6 +1073,68 @@ func Test_ArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func Test_SliceExpressions(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4][-10:10]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][3:1]", "[]"},
+		{"[1, 2, 3, 4][5:]", "[]"},
+		{"let n = 1; [1, 2, 3, 4][n:n + 2]", "[2, 3]"},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[-3:]`, "llo"},
+		{`"héllo"[:2]`, "hé"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[-1]`, "o"},
+		{`len("héllo")`, "5"},
+		{`null?.[1:]`, "null"},
+		{`"abc"[1:"b"]`, "slice bounds must be INTEGER, got STRING"},
+		{`{"a": 1}[0:1]`, "slice operator not supported: HASH"},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. want=%q, got=%q", tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s wrong. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func Test_StringIndexExpressions(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[3]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+		str, ok := tt.expected.(string)
+		if ok {
+			testStringObject(t, evaluated, str)
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func Test_ArrayBuiltins(t *testing.T) {
 	testData := []struct {
 		input    string
@@ -430,14 +1193,15 @@ func Test_HashLiterals(t *testing.T) {
 		(&object.Boolean{Value: false}).HashKey():  6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong number of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong number of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, pair := range result.Pairs() {
+		key, _ := object.HashKeyOf(pair.Key)
+		expectedValue, ok := expected[key]
 		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+			t.Errorf("unexpected key in Pairs: %s", pair.Key.Inspect())
 		}
 
 		testIntegerObject(t, pair.Value, expectedValue)
@@ -455,6 +1219,13 @@ func Test_HashIndexExpressions(t *testing.T) {
 		{`{5: 5}[5]`, 5},
 		{`{true: 5}[true]`, 5},
 		{`{false: 5}[false]`, 5},
+		{`let x = 1; let y = 2; {[x, y]: 5}[[1, 2]]`, 5},
+		{`{[1, 2]: 5}[[2, 1]]`, nil},
+		{`{[[1], "a"]: 5}[[[1], "a"]]`, 5},
+		{`{{"a": 1, "b": 2}: 5}[{"b": 2, "a": 1}]`, 5},
+		{`{{"a": 1}: 5}[{"a": 2}]`, nil},
+		{`{[]: 5}[[]]`, 5},
+		{`{[]: 5}[{}]`, nil},
 	}
 
 	for _, tt := range testData {
@@ -513,6 +1284,10 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 		t.Errorf("object has wrong value, got %t, want %t", result.Value, expected)
 		return false
 	}
+	if result != object.NativeBool(expected) {
+		t.Errorf("object is a new Boolean, not the %t singleton", expected)
+		return false
+	}
 	return true
 }
 
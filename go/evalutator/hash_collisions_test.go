@@ -0,0 +1,40 @@
+package evalutator
+
+import (
+	"testing"
+
+	"alde.nu/mint/internal/hashtest"
+)
+
+func Test_HashIndexWithCollisions(t *testing.T) {
+	restore := hashtest.ForceCollisions()
+	defer restore()
+
+	testData := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"a": 1, "b": 2}["a"]`, 1},
+		{`{"a": 1, "b": 2}["b"]`, 2},
+		{`{"a": 1, "b": 2}["c"]`, nil},
+		{`{"a": 1, 1: 2, true: 3}[true]`, 3},
+		{`{[1, 2]: 1, [2, 1]: 2}[[2, 1]]`, 2},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1, "b": 2} == {"a": 2, "b": 1}`, false},
+	}
+
+	for _, tt := range testData {
+		evaluated := testEval(tt.input)
+
+		if boolean, ok := tt.expected.(bool); ok {
+			testBooleanObject(t, evaluated, boolean)
+			continue
+		}
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
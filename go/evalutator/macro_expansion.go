@@ -0,0 +1,162 @@
+package evalutator
+
+import (
+	"context"
+	"fmt"
+
+	"alde.nu/mint/ast"
+	"alde.nu/mint/object"
+)
+
+// DefineMacros moves every top-level `let name = macro(...) { ... }` out
+// of the program and into env, so ExpandMacros can find them.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	definitions := []int{}
+
+	for i, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	for i := len(definitions) - 1; i >= 0; i-- {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok || letStatement.Name == nil {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// ExpandMacros replaces every call to a macro defined in env with the
+// quoted node the macro returns. The first failing expansion stops the
+// expansion and is returned as an error. The macros are evaluated with
+// the limits opts set, shared by the whole expansion.
+func ExpandMacros(program ast.Node, env *object.Environment, opts ...Option) (ast.Node, error) {
+	return ExpandMacrosContext(context.Background(), program, env, opts...)
+}
+
+// ExpandMacrosContext is ExpandMacros stopping with an error when ctx is
+// done.
+func ExpandMacrosContext(ctx context.Context, program ast.Node, env *object.Environment, opts ...Option) (ast.Node, error) {
+	var expandErr error
+	e := New(opts...)
+	defer e.start(ctx)()
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if expandErr != nil {
+			return node
+		}
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+		name := callExpression.Function.String()
+		if len(callExpression.Arguments) != len(macro.Parameters) {
+			expandErr = fmt.Errorf("wrong number of arguments to macro %s: want=%d, got=%d",
+				name, len(macro.Parameters), len(callExpression.Arguments))
+			return node
+		}
+
+		args := quoteArgs(callExpression)
+		evalEnv := extendMacroEnv(macro, args)
+
+		e.envs = []*object.Environment{evalEnv}
+		evaluated := unwrapReturnValue(e.Eval(macro.Body, evalEnv))
+		switch err := evaluated.(type) {
+		case *object.Error:
+			expandErr = fmt.Errorf("macro %s: %s", name, err.Message)
+			return node
+		case *object.LimitError:
+			expandErr = fmt.Errorf("macro %s: %w", name, err)
+			return node
+		}
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			expandErr = fmt.Errorf("macro %s must return a quoted expression, got %s", name, typeOf(evaluated))
+			return node
+		}
+
+		return quote.Node
+	})
+
+	if expandErr != nil {
+		return nil, expandErr
+	}
+	return expanded, nil
+}
+
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
+	extended := object.EncaseEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+
+	return extended
+}
+
+func typeOf(obj object.Object) string {
+	if obj == nil {
+		return "nothing"
+	}
+	return string(obj.Type())
+}
@@ -0,0 +1,183 @@
+package evalutator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"alde.nu/mint/ast"
+	"alde.nu/mint/lexer"
+	"alde.nu/mint/object"
+	"alde.nu/mint/parser"
+)
+
+func Test_DefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.CreateEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameters wrong. got=%v", macro.Parameters)
+	}
+	if macro.Body.String() != "(x + y)" {
+		t.Fatalf("body is not %q. got=%q", "(x + y)", macro.Body.String())
+	}
+}
+
+func Test_ExpandMacros(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); };
+			infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+			reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+	}
+
+	for _, tt := range testData {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.CreateEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func Test_ExpandMacrosErrors(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let m = macro(a) { quote(unquote(a)); }; m(1, 2);`,
+			"wrong number of arguments to macro m: want=1, got=2",
+		},
+		{
+			`let m = macro() { 1 }; m();`,
+			"macro m must return a quoted expression, got INTEGER",
+		},
+		{
+			`let m = macro() { nope }; m();`,
+			"macro m: identifier not found: nope",
+		},
+	}
+
+	for _, tt := range testData {
+		program := testParseProgram(tt.input)
+
+		env := object.CreateEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Fatalf("expected an error for %q", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func Test_ExpandMacrosLimits(t *testing.T) {
+	input := `let m = macro() { let f = fn(n) { f(n + 1) }; f(0) }; m(); 1`
+
+	program := testParseProgram(input)
+	env := object.CreateEnvironment()
+	DefineMacros(program, env)
+	_, err := ExpandMacros(program, env, WithStepLimit(1000))
+	if err == nil || err.Error() != "macro m: step limit of 1000 exceeded" {
+		t.Errorf("wrong error for the step limit. got=%v", err)
+	}
+
+	program = testParseProgram(input)
+	env = object.CreateEnvironment()
+	DefineMacros(program, env)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ExpandMacrosContext(cancelled, program, env)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected an error for context.Canceled, got %v", err)
+	}
+}
+
+func Test_UnlessMacroEvaluation(t *testing.T) {
+	input := `
+	let unless = macro(condition, consequence, alternative) {
+		quote(if (!(unquote(condition))) {
+			unquote(consequence);
+		} else {
+			unquote(alternative);
+		});
+	};
+	unless(10 > 5, 1, 2);
+	`
+
+	program := testParseProgram(input)
+	macroEnv := object.CreateEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testIntegerObject(t, Eval(expanded, object.CreateEnvironment()), 2)
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.Create(input)
+	p := parser.Create(l)
+	return p.ParseProgram()
+}
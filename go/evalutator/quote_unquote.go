@@ -0,0 +1,75 @@
+package evalutator
+
+import (
+	"alde.nu/mint/ast"
+	"alde.nu/mint/object"
+	"alde.nu/mint/token"
+)
+
+func (e *Evaluator) quote(node ast.Node, env *object.Environment) object.Object {
+	node = e.evalUnquoteCalls(node, env)
+	return &object.Quote{Node: node}
+}
+
+// evalUnquoteCalls replaces every `unquote(x)` inside a quoted node with
+// the evaluated x turned back into an AST node.
+func (e *Evaluator) evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
+	return ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if !isUnquoteCall(node) {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			return node
+		}
+
+		unquoted := e.Eval(call.Arguments[0], env)
+		if converted := convertObjectToASTNode(unquoted); converted != nil {
+			return converted
+		}
+		// Leave it in place, so evaluating it reports the problem
+		return node
+	})
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return callExpression.Function.TokenLiteral() == "unquote"
+}
+
+func convertObjectToASTNode(obj object.Object) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: obj.Inspect(),
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+	case *object.Null:
+		t := token.Token{Type: token.NULL, Literal: "null"}
+		return &ast.NullLiteral{Token: t}
+	case *object.Quote:
+		return obj.Node
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"alde.nu/mint/format"
+)
+
+// runFmt implements `mint fmt [-w] [-d] [path ...]`. Without paths it
+// formats standard input to standard output.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result back to the source file instead of standard output")
+	diff := flags.Bool("d", false, "print a diff instead of the formatted source")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: mint fmt [-w] [-d] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "mint fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mint fmt: %s\n", err)
+			return 1
+		}
+		if err := formatSource("<standard input>", src, false, *diff); err != nil {
+			fmt.Fprintf(os.Stderr, "mint fmt: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = formatSource(path, src, *write, *diff)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mint fmt: %s\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func formatSource(path string, src []byte, write, diff bool) error {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if diff {
+		os.Stdout.WriteString(unifiedDiff(path, src, formatted))
+	}
+	if write {
+		if bytes.Equal(src, formatted) {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, formatted, info.Mode().Perm())
+	}
+	if !diff {
+		os.Stdout.Write(formatted)
+	}
+	return nil
+}
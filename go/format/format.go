@@ -0,0 +1,43 @@
+// Package format prints Mint programs in the canonical style used by
+// `mint fmt`: one statement per line, tab indentation, minimal
+// parentheses and comments kept where they were.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"alde.nu/mint/ast"
+	"alde.nu/mint/lexer"
+	"alde.nu/mint/parser"
+)
+
+// Source formats src, which must be a complete program. Formatting the
+// result again gives the same bytes back.
+func Source(src []byte) ([]byte, error) {
+	l := lexer.Create(string(src))
+	l.KeepComments()
+	p := parser.Create(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+
+	var buf bytes.Buffer
+	if err := Node(&buf, program); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Node writes program in canonical style to w, along with the comments
+// the parser collected in program.Comments.
+func Node(w io.Writer, program *ast.Program) error {
+	p := &printer{comments: program.Comments}
+	p.statementList(program.Statements, endOfFile)
+
+	_, err := io.WriteString(w, p.out.String())
+	return err
+}
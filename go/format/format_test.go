@@ -0,0 +1,224 @@
+package format
+
+import (
+	"testing"
+
+	"alde.nu/mint/lexer"
+	"alde.nu/mint/parser"
+)
+
+func Test_Source(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"let x = 1;;;\n\n\n\nlet y = 2", "let x = 1;\n\nlet y = 2;\n"},
+		{"1 + 2 * 3", "1 + 2 * 3;\n"},
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3);\n"},
+		{"(1 - 2) - 3", "1 - 2 - 3;\n"},
+		{"2 ** (3 ** 2)", "2 ** 3 ** 2;\n"},
+		{"(2 ** 3) ** 2", "(2 ** 3) ** 2;\n"},
+		{"(-2) ** 2", "(-2) ** 2;\n"},
+		{"-(2 ** 2)", "-2 ** 2;\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"!(-a)", "!-a;\n"},
+		{"a ?? (b || c)", "a ?? b || c;\n"},
+		{"(a ?? b) || c", "(a ?? b) || c;\n"},
+		{"(a + b)(c)[0]", "(a + b)(c)[0];\n"},
+		{"a?.[0]?.(1)[1:][:2][:]", "a?.[0]?.(1)[1:][:2][:];\n"},
+		{`{"a":1,"b":[1,2]}`, "{\"a\": 1, \"b\": [1, 2]};\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"let f = fn(a,b){return a+b}", "let f = fn(a, b) {\n\treturn a + b;\n};\n"},
+		{"let m = macro(a){quote(unquote(a))}", "let m = macro(a) {\n\tquote(unquote(a));\n};\n"},
+		{
+			"if(x){1}else{if(y){2}}",
+			"if (x) {\n\t1;\n} else {\n\tif (y) {\n\t\t2;\n\t}\n}\n",
+		},
+		{"if (x) { 1 }; -1", "if (x) {\n\t1;\n};\n-1;\n"},
+		{"if (x) { 1 }; 1", "if (x) {\n\t1;\n}\n1;\n"},
+		{"try{f()}catch(e){throw e}finally{g()}", "try {\n\tf();\n} catch (e) {\n\tthrow e;\n} finally {\n\tg();\n}\n"},
+		{"let r = try { 1 } finally {}", "let r = try {\n\t1;\n} finally {};\n"},
+		{"let [a,_,...r] = xs", "let [a, _, ...r] = xs;\n"},
+		{"0x1F + 1_000 - 0b11", "0x1F + 1_000 - 0b11;\n"},
+		{`let {a, b: c, "d e": f, ...r} = h`, "let {a, b: c, \"d e\": f, ...r} = h;\n"},
+		{`let {"a": a} = h`, "let {a} = h;\n"},
+		{`"a ${x+1} b ${ "c ${y}" }"`, "\"a ${x + 1} b ${\"c ${y}\"}\";\n"},
+		{`"\${x} $ \\${y} a\b"`, "\"\\${x} $ \\\\${y} a\\b\";\n"},
+		{`"say \"hi\" \\"`, "\"say \\\"hi\\\" \\\\\";\n"},
+		{
+			`match (x) { 0 => "zero", -1 => "neg", [h, ...t] if h > 0 => t, _ => null }`,
+			"match (x) {\n\t0 => \"zero\",\n\t-1 => \"neg\",\n\t[h, ...t] if h > 0 => t,\n\t_ => null,\n}\n",
+		},
+		{
+			`match (x) { 1 => { let a = 2; a }, _ => {} }`,
+			"match (x) {\n\t1 => {\n\t\tlet a = 2;\n\t\ta;\n\t},\n\t_ => {},\n}\n",
+		},
+	}
+
+	for _, tt := range testData {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.input, err)
+			continue
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("wrong formatting for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func Test_SourceComments(t *testing.T) {
+	input := `// header
+
+let x = 1;   // one
+// about f
+let f = fn(a) { // opening
+	// inside
+	a
+	// before close
+};
+let m = match (x) {
+	// first
+	0 => 1, // zero
+	_ => 2
+};
+let e = fn() {
+	// nothing yet
+};
+// footer
+`
+	expected := `// header
+
+let x = 1; // one
+// about f
+let f = fn(a) {
+	// opening
+	// inside
+	a;
+	// before close
+};
+let m = match (x) {
+	// first
+	0 => 1, // zero
+	_ => 2,
+};
+let e = fn() {
+	// nothing yet
+};
+// footer
+`
+
+	formatted, err := Source([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(formatted) != expected {
+		t.Errorf("wrong formatting.\nwant:\n%s\ngot:\n%s", expected, formatted)
+	}
+}
+
+func Test_SourceCommentsInExpressions(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let f = fn(x) { x }; // note\nf(1)",
+			"let f = fn(x) {\n\tx;\n}; // note\nf(1);\n",
+		},
+		{
+			"let h = {\n\t\"a\": 1, // one\n\t// before b\n\t\"b\": f(1, // arg\n\t\t2),\n};\nputs(h)",
+			"let h = {\n\t\"a\": 1, // one\n\t// before b\n\t\"b\": f(\n\t\t1, // arg\n\t\t2\n\t)\n};\nputs(h);\n",
+		},
+		{
+			"let xs = [1, 2, // two\n3 // three\n];",
+			"let xs = [\n\t1,\n\t2, // two\n\t3 // three\n];\n",
+		},
+		{
+			"f(a,\n[1, 2]\n// last\n)",
+			"f(\n\ta,\n\t[1, 2]\n\t// last\n);\n",
+		},
+	}
+
+	for _, tt := range testData {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.input, err)
+			continue
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("wrong formatting for %q.\nwant:\n%s\ngot:\n%s", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func Test_SourceIsIdempotent(t *testing.T) {
+	inputs := []string{
+		"let x = 1; let y = fn(a) { if (a) { a } else { -a } }; y(x)",
+		"// only a comment",
+		"",
+		"let h = {\"a\": [1,\n2], // values\n\"b\": 2};\nputs(h)",
+		"match (xs) {\n\n[] => 0,\n\n\n[x, ...rest] => x }\n-1",
+		"if (a) {}\n[1][0]\nif (b) { 1 } else { 2 }\n(fn() { 3 })()",
+		"let f = fn(x) { x }; // note\nlet h = {\"a\": 1, // one\n\"b\": f(1, // arg\n2)}",
+	}
+
+	for _, input := range inputs {
+		once, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", input, err)
+			continue
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Errorf("formatted source doesn't parse for %q: %s", input, err)
+			continue
+		}
+		if string(once) != string(twice) {
+			t.Errorf("formatting isn't idempotent for %q.\nonce= %q\ntwice=%q", input, once, twice)
+		}
+	}
+}
+
+func Test_SourceKeepsMeaning(t *testing.T) {
+	inputs := []string{
+		"a - (b - c) * d ** (e ** f) % g",
+		"-a ** b + (-a) ** b + !(a == b) != c",
+		"a && (b || c) ?? d & e | f ^ g << h >> i",
+		"f(a)(b)[c][d:e]?.[f]?.(g)",
+		"if (a) { b } else { c }; -d; (e); [f]",
+		"let g = fn(x) { match (x) { {a: [b, ...c]} if b => c, _ => x } }",
+		`"\\${a} \\\\${b}\\ ${ "c\\\\" } $"`,
+		`"\"${ "\\" }\\\" \\"`,
+	}
+
+	for _, input := range inputs {
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", input, err)
+			continue
+		}
+		if got, want := parse(t, string(formatted)), parse(t, input); got != want {
+			t.Errorf("formatting changed the program.\nwant=%s\ngot= %s", want, got)
+		}
+	}
+}
+
+func Test_SourceParseError(t *testing.T) {
+	if _, err := Source([]byte("let = 1")); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+// parse returns the fully parenthesized form of input.
+func parse(t *testing.T, input string) string {
+	t.Helper()
+	p := parser.Create(lexer.Create(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
@@ -0,0 +1,550 @@
+package format
+
+import (
+	"math"
+	"strings"
+
+	"alde.nu/mint/ast"
+	"alde.nu/mint/parser"
+	"alde.nu/mint/token"
+)
+
+// endOfFile is past every comment, so closing a program prints the rest.
+var endOfFile = token.Position{Line: math.MaxInt, Column: math.MaxInt}
+
+// atomic is the precedence of everything that never needs parentheses.
+const atomic = parser.INDEX + 1
+
+type printer struct {
+	out      strings.Builder
+	indent   int
+	comments []*ast.Comment // the ones not printed yet
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) writeIndent() {
+	p.write(strings.Repeat("\t", p.indent))
+}
+
+// separate keeps a blank line between two lines of the source that had
+// at least one between them. Longer runs of blank lines are collapsed.
+func (p *printer) separate(prevLine, line int) {
+	if prevLine > 0 && line > prevLine+1 {
+		p.write("\n")
+	}
+}
+
+// leadingComments prints the comments found before pos, each on its own
+// line, and returns the line the last one was on.
+func (p *printer) leadingComments(pos token.Position, prevLine int) int {
+	for len(p.comments) > 0 && before(p.comments[0].Pos(), pos) {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		p.separate(prevLine, comment.Pos().Line)
+		p.writeIndent()
+		p.write(comment.Token.Literal)
+		p.write("\n")
+		// Comments from inside the expression before it come after it
+		prevLine = max(prevLine, comment.Pos().Line)
+	}
+	return prevLine
+}
+
+// trailingComment prints a comment found on line, and before end, after
+// what was printed for it rather than on a line of its own.
+func (p *printer) trailingComment(line int, end token.Position) {
+	if len(p.comments) > 0 && p.comments[0].Pos().Line == line && before(p.comments[0].Pos(), end) {
+		p.write(" ")
+		p.write(p.comments[0].Token.Literal)
+		p.comments = p.comments[1:]
+	}
+}
+
+func (p *printer) hasCommentBefore(pos token.Position) bool {
+	return len(p.comments) > 0 && before(p.comments[0].Pos(), pos)
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// lastLine is the last line of the source node was parsed from, as far as
+// the tree remembers it.
+func lastLine(node ast.Node) int {
+	last := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		last = max(last, n.Pos().Line)
+		switch n := n.(type) {
+		case *ast.BlockStatement:
+			last = max(last, n.Rbrace.Line)
+		case *ast.MatchExpression:
+			last = max(last, n.Rbrace.Line)
+		case *ast.HashLiteral:
+			last = max(last, n.Rbrace.Line)
+		case *ast.ArrayLiteral:
+			last = max(last, n.Rbracket.Line)
+		case *ast.CallExpression:
+			last = max(last, n.Rparen.Line)
+		}
+		return true
+	})
+	return last
+}
+
+// statementList prints one statement per line, at the current
+// indentation, followed by the comments found before end.
+func (p *printer) statementList(list []ast.Statement, end token.Position) {
+	prevLine := 0
+	for i, stmt := range list {
+		prevLine = p.leadingComments(stmt.Pos(), prevLine)
+		p.separate(prevLine, stmt.Pos().Line)
+
+		var next ast.Statement
+		if i+1 < len(list) {
+			next = list[i+1]
+		}
+		p.writeIndent()
+		p.statement(stmt, next)
+
+		prevLine = max(lastLine(stmt), stmt.Pos().Line)
+		p.trailingComment(prevLine, end)
+		p.write("\n")
+	}
+	p.leadingComments(end, prevLine)
+}
+
+func (p *printer) statement(stmt ast.Statement, next ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		if stmt.Pattern != nil {
+			p.pattern(stmt.Pattern)
+		} else {
+			p.write(stmt.Name.Value)
+		}
+		p.write(" = ")
+		p.expression(stmt.Value)
+		p.write(";")
+
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue)
+		}
+		p.write(";")
+
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value)
+		p.write(";")
+
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+		if needsSemicolon(stmt, next) {
+			p.write(";")
+		}
+
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+// needsSemicolon leaves it out after an if, a try or a match, which end
+// with a brace anyway, unless the next statement would read as their
+// continuation, as in `if (a) { b };` followed by `-c` or `[c]`.
+func needsSemicolon(stmt *ast.ExpressionStatement, next ast.Statement) bool {
+	switch stmt.Expression.(type) {
+	case *ast.IfExpression, *ast.TryExpression, *ast.MatchExpression:
+	default:
+		return true
+	}
+
+	nextStmt, ok := next.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	switch nextStmt.Token.Type {
+	case token.MINUS, token.LPAREN, token.LBRACKET:
+		return true
+	}
+	return false
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !p.hasCommentBefore(block.Rbrace) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{\n")
+	p.indent++
+	p.statementList(block.Statements, block.Rbrace)
+	p.indent--
+	p.writeIndent()
+	p.write("}")
+}
+
+func precedenceOf(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(exp.Operator))
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	default:
+		return atomic
+	}
+}
+
+// operand prints exp in parentheses when it binds looser than prec.
+func (p *printer) operand(exp ast.Expression, prec int) {
+	if precedenceOf(exp) < prec {
+		p.write("(")
+		p.expression(exp)
+		p.write(")")
+		return
+	}
+	p.expression(exp)
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+
+	case *ast.IntegerLiteral:
+		// The literal keeps the spelling it was written with
+		if exp.Token.Literal != "" {
+			p.write(exp.Token.Literal)
+		} else {
+			p.write(exp.String())
+		}
+
+	case *ast.StringLiteral:
+		p.write(`"` + escape(exp.Value, false) + `"`)
+
+	case *ast.InterpolatedString:
+		p.write(`"`)
+		for i, text := range exp.Strings {
+			more := i < len(exp.Expressions)
+			p.write(escape(text, more))
+			if more {
+				p.write("${")
+				p.expression(exp.Expressions[i])
+				p.write("}")
+			}
+		}
+		p.write(`"`)
+
+	case *ast.Boolean:
+		p.write(exp.String())
+
+	case *ast.NullLiteral:
+		p.write("null")
+
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		// Prefix operators bind looser than ** only, which is never
+		// ambiguous on their right side
+		if _, ok := exp.Right.(*ast.PrefixExpression); ok {
+			p.expression(exp.Right)
+		} else {
+			p.operand(exp.Right, parser.PREFIX+1)
+		}
+
+	case *ast.InfixExpression:
+		p.infix(exp)
+
+	case *ast.CallExpression:
+		p.operand(exp.Function, parser.CALL)
+		if exp.Optional {
+			p.write("?.")
+		}
+		p.list("(", ")", exp.Rparen, len(exp.Arguments), func(i int) []ast.Expression {
+			return exp.Arguments[i : i+1]
+		}, func(i int) {
+			p.expression(exp.Arguments[i])
+		})
+
+	case *ast.IndexExpression:
+		p.operand(exp.Left, parser.INDEX)
+		if exp.Optional {
+			p.write("?.")
+		}
+		p.write("[")
+		p.expression(exp.Index)
+		p.write("]")
+
+	case *ast.SliceExpression:
+		p.operand(exp.Left, parser.INDEX)
+		if exp.Optional {
+			p.write("?.")
+		}
+		p.write("[")
+		if exp.Low != nil {
+			p.expression(exp.Low)
+		}
+		p.write(":")
+		if exp.High != nil {
+			p.expression(exp.High)
+		}
+		p.write("]")
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(exp.Block)
+		if exp.Catch != nil {
+			p.write(" catch (" + exp.Parameter.Value + ") ")
+			p.block(exp.Catch)
+		}
+		if exp.Finally != nil {
+			p.write(" finally ")
+			p.block(exp.Finally)
+		}
+
+	case *ast.MatchExpression:
+		p.match(exp)
+
+	case *ast.FunctionLiteral:
+		p.write("fn")
+		p.parameters(exp.Parameters)
+		p.write(" ")
+		p.block(exp.Body)
+
+	case *ast.MacroLiteral:
+		p.write("macro")
+		p.parameters(exp.Parameters)
+		p.write(" ")
+		p.block(exp.Body)
+
+	case *ast.ArrayLiteral:
+		p.list("[", "]", exp.Rbracket, len(exp.Elements), func(i int) []ast.Expression {
+			return exp.Elements[i : i+1]
+		}, func(i int) {
+			p.expression(exp.Elements[i])
+		})
+
+	case *ast.HashLiteral:
+		p.list("{", "}", exp.Rbrace, len(exp.Pairs), func(i int) []ast.Expression {
+			return []ast.Expression{exp.Pairs[i].Key, exp.Pairs[i].Value}
+		}, func(i int) {
+			p.expression(exp.Pairs[i].Key)
+			p.write(": ")
+			p.expression(exp.Pairs[i].Value)
+		})
+	}
+}
+
+// escape writes the text of a string so it reads back the same: a $ that
+// would start an expression as \$, a quote as \", and a backslash that
+// would escape what follows it as \\. beforeExpression tells that the
+// text is followed by ${, otherwise it is followed by the closing quote.
+func escape(text string, beforeExpression bool) string {
+	var out strings.Builder
+	for i := 0; i < len(text); i++ {
+		next := byte('"')
+		if i+1 < len(text) {
+			next = text[i+1]
+		} else if beforeExpression {
+			next = '$'
+		}
+
+		switch {
+		case text[i] == '\\' && (next == '\\' || next == '$' || next == '"'):
+			out.WriteString(`\\`)
+		case text[i] == '"':
+			out.WriteString(`\"`)
+		case text[i] == '$' && next == '{':
+			out.WriteString(`\$`)
+		default:
+			out.WriteByte(text[i])
+		}
+	}
+	return out.String()
+}
+
+func (p *printer) infix(exp *ast.InfixExpression) {
+	prec := precedenceOf(exp)
+
+	// Operators associate to the left, except ** which associates to the
+	// right. The side they don't associate to needs parentheses for an
+	// operator of the same precedence.
+	leftPrec, rightPrec := prec, prec+1
+	if exp.Operator == token.POWER {
+		leftPrec, rightPrec = prec+1, prec
+	}
+
+	p.operand(exp.Left, leftPrec)
+	p.write(" " + exp.Operator + " ")
+	if _, ok := exp.Right.(*ast.PrefixExpression); ok {
+		p.expression(exp.Right)
+	} else {
+		p.operand(exp.Right, rightPrec)
+	}
+}
+
+// list prints the n elements of an array, a hash or the arguments of a
+// call between open and close, which is at end, on one line. With comments
+// among them each element goes on a line of its own instead, so that the
+// comments stay where they were. parts are the expressions element i is
+// made of, and print prints it.
+func (p *printer) list(open, close string, end token.Position, n int, parts func(i int) []ast.Expression, print func(i int)) {
+	if !p.hasCommentBefore(end) {
+		p.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			print(i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.write(open + "\n")
+	p.indent++
+	prevLine := 0
+	for i := 0; i < n; i++ {
+		pos := parts(i)[0].Pos()
+		prevLine = p.leadingComments(pos, prevLine)
+		p.separate(prevLine, pos.Line)
+		p.writeIndent()
+		print(i)
+
+		next := end
+		if i+1 < n {
+			p.write(",")
+			next = parts(i + 1)[0].Pos()
+		}
+		prevLine = 0
+		for _, part := range parts(i) {
+			prevLine = max(prevLine, lastLine(part))
+		}
+		p.trailingComment(prevLine, next)
+		p.write("\n")
+	}
+	p.leadingComments(end, prevLine)
+	p.indent--
+	p.writeIndent()
+	p.write(close)
+}
+
+func (p *printer) parameters(params []*ast.Identifier) {
+	names := []string{}
+	for _, param := range params {
+		names = append(names, param.Value)
+	}
+	p.write("(" + strings.Join(names, ", ") + ")")
+}
+
+// match prints one arm per line, each followed by a comma.
+func (p *printer) match(exp *ast.MatchExpression) {
+	p.write("match (")
+	p.expression(exp.Subject)
+	p.write(") ")
+	if len(exp.Arms) == 0 && !p.hasCommentBefore(exp.Rbrace) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{\n")
+	p.indent++
+	prevLine := 0
+	for _, arm := range exp.Arms {
+		prevLine = p.leadingComments(arm.Pos(), prevLine)
+		p.separate(prevLine, arm.Pos().Line)
+
+		p.writeIndent()
+		p.pattern(arm.Pattern)
+		if arm.Guard != nil {
+			p.write(" if ")
+			p.expression(arm.Guard)
+		}
+		p.write(" => ")
+		if block, ok := arm.Body.(*ast.BlockStatement); ok {
+			p.block(block)
+		} else {
+			p.expression(arm.Body)
+		}
+		p.write(",")
+
+		prevLine = max(lastLine(arm), arm.Pos().Line)
+		p.trailingComment(prevLine, exp.Rbrace)
+		p.write("\n")
+	}
+	p.leadingComments(exp.Rbrace, prevLine)
+	p.indent--
+	p.writeIndent()
+	p.write("}")
+}
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		p.write(pattern.Value)
+
+	case *ast.WildcardPattern:
+		p.write("_")
+
+	case *ast.LiteralPattern:
+		p.expression(pattern.Value)
+
+	case *ast.ArrayPattern:
+		p.write("[")
+		for i, el := range pattern.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(el)
+		}
+		p.rest(pattern.Rest, len(pattern.Elements) > 0)
+		p.write("]")
+
+	case *ast.HashPattern:
+		p.write("{")
+		for i, pair := range pattern.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			key := pair.Key
+			if !ast.IsIdentifierName(key) {
+				key = `"` + escape(key, false) + `"`
+			} else if ident, ok := pair.Value.(*ast.Identifier); ok && ident.Value == pair.Key {
+				// The shorthand {name}
+				p.write(key)
+				continue
+			}
+			p.write(key + ": ")
+			p.pattern(pair.Value)
+		}
+		p.rest(pattern.Rest, len(pattern.Pairs) > 0)
+		p.write("}")
+	}
+}
+
+func (p *printer) rest(rest *ast.Identifier, afterOthers bool) {
+	if rest == nil {
+		return
+	}
+	if afterOthers {
+		p.write(", ")
+	}
+	p.write("..." + rest.Value)
+}
@@ -0,0 +1,16 @@
+// Package hashtest lets the tests of the packages that use hashes make
+// every hashable value hash alike, to check that hashes tell colliding keys
+// apart. Being internal, it is out of reach of code outside the module.
+package hashtest
+
+// Colliding makes object.HashKeyOf return the same key for every hashable
+// value while it is true.
+var Colliding bool
+
+// ForceCollisions sets Colliding until restore is called. It is not safe
+// to use while other goroutines are hashing.
+func ForceCollisions() (restore func()) {
+	previous := Colliding
+	Colliding = true
+	return func() { Colliding = previous }
+}
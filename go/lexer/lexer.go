@@ -1,33 +1,119 @@
 package lexer
 
 import (
+	"bufio"
+	"io"
+	"strings"
+
 	"alde.nu/mint/token"
 )
 
 type Lexer struct {
-	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position (after current char)
-	ch           byte // current char under examination
+	r      *bufio.Reader
+	err    error // the first read error other than io.EOF
+	ch     byte  // current char under examination
+	line   int   // line of the current char
+	column int   // column of the current char
+
+	keepComments bool
+	comments     []token.Token // only with keepComments
+	pending      []token.Token // peeked or unread, handed out before scanning more
+
+	warnEscapes bool
+	warnings    []string // only with warnEscapes
+
+	// The brace depth inside each ${ } of an interpolated string being
+	// lexed, innermost last. Its closing } carries on with the string.
+	interpolations []int
 }
 
 func Create(input string) *Lexer {
-	l := &Lexer{input: input}
+	return CreateFromReader(strings.NewReader(input))
+}
+
+// CreateFromReader lexes the source as it is read from r, so it never
+// has to be in memory all at once.
+func CreateFromReader(r io.Reader) *Lexer {
+	l := &Lexer{r: bufio.NewReader(r), line: 1}
 	l.readChar()
 	return l
 }
 
+// StartAtLine numbers the lines of the source from line on, for sources
+// that continue an earlier one like the lines entered in the REPL. It must
+// be called before the first token is read.
+func (l *Lexer) StartAtLine(line int) {
+	l.line = line
+}
+
+// KeepComments makes the lexer collect the // comments it skips, for
+// Comments to return. Without it they are dropped once skipped, so a long
+// stream is lexed without holding on to its comments. It must be called
+// before the first token is read.
+func (l *Lexer) KeepComments() {
+	l.keepComments = true
+}
+
+// WarnChangedEscapes makes the lexer record a warning for every escape in
+// a string literal, which kept its backslash before strings had escapes,
+// for Warnings to return. It must be called before the first token is
+// read.
+func (l *Lexer) WarnChangedEscapes() {
+	l.warnEscapes = true
+}
+
+// Warnings returns the warnings recorded with WarnChangedEscapes, each
+// starting with the line and column it is about.
+func (l *Lexer) Warnings() []string {
+	return l.warnings
+}
+
+// Err returns the first error reading the source failed with. The lexer
+// treats it as the end of the source.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
 func (l *Lexer) NextToken() token.Token {
+	if len(l.pending) > 0 {
+		tok := l.pending[0]
+		l.pending = l.pending[1:]
+		return tok
+	}
+	return l.scan()
+}
+
+// PeekToken returns the token n places after the one NextToken returns
+// next, which is PeekToken(0), without consuming any of them.
+func (l *Lexer) PeekToken(n int) token.Token {
+	for len(l.pending) <= n {
+		l.pending = append(l.pending, l.scan())
+	}
+	return l.pending[n]
+}
+
+// UnreadToken puts tok back, so NextToken returns it again. Tokens can be
+// unread any number of times, the last one unread is returned first.
+func (l *Lexer) UnreadToken(tok token.Token) {
+	l.pending = append([]token.Token{tok}, l.pending...)
+}
+
+func (l *Lexer) scan() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	for l.ch == '/' && l.peekAhead() == '/' {
+		l.readComment()
+		l.skipWhitespace()
+	}
+	pos := token.Position{Line: l.line, Column: l.column}
 	switch l.ch {
 	case '=':
-		if l.peekAhead() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
-		} else {
+		switch l.peekAhead() {
+		case '=':
+			tok = l.twoCharToken(token.EQ)
+		case '>':
+			tok = l.twoCharToken(token.ARROW)
+		default:
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case ';':
@@ -41,31 +127,93 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		n := len(l.interpolations)
+		switch {
+		case n > 0 && l.interpolations[n-1] == 0:
+			l.interpolations = l.interpolations[:n-1]
+			tok = l.readStringPart(false)
+		case n > 0:
+			l.interpolations[n-1]--
+			tok = newToken(token.RBRACE, l.ch)
+		default:
+			tok = newToken(token.RBRACE, l.ch)
+		}
 	case '-':
 		tok = newToken(token.MINUS, l.ch)
 	case '/':
 		tok = newToken(token.SLASH, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekAhead() == '*' {
+			tok = l.twoCharToken(token.POWER)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekAhead() {
+		case '=':
+			tok = l.twoCharToken(token.LT_EQ)
+		case '<':
+			tok = l.twoCharToken(token.LSHIFT)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekAhead() {
+		case '=':
+			tok = l.twoCharToken(token.GT_EQ)
+		case '>':
+			tok = l.twoCharToken(token.RSHIFT)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
 	case '!':
 		if l.peekAhead() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = l.twoCharToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '&':
+		if l.peekAhead() == '&' {
+			tok = l.twoCharToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekAhead() == '|' {
+			tok = l.twoCharToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '?':
+		switch l.peekAhead() {
+		case '?':
+			tok = l.twoCharToken(token.NULLISH)
+		case '.':
+			tok = l.twoCharToken(token.OPTIONAL)
+		default:
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '.':
+		if l.peekAhead() == '.' && l.peekAheadN(2) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readStringPart(true)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -79,10 +227,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -90,6 +240,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 	l.readChar()
 
+	tok.Pos = pos
 	return tok
 }
 
@@ -99,31 +250,90 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// Comments returns the // comments skipped so far, in source order, if
+// KeepComments was called.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+func (l *Lexer) readComment() {
+	pos := token.Position{Line: l.line, Column: l.column}
+	out := strings.Builder{}
+	for l.ch != '\n' && l.ch != 0 {
+		if l.keepComments {
+			out.WriteByte(l.ch)
+		}
+		l.readChar()
+	}
+	if !l.keepComments {
+		return
+	}
+	text := strings.TrimRight(out.String(), " \t\r")
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: text, Pos: pos})
+}
+
+// readNumber reads everything that could belong to a number, such as
+// 0xFF or 1_000, and leaves it to the parser to reject malformed ones.
 func (l *Lexer) readNumber() string {
-	position := l.position
-	for isDigit(l.ch) {
+	out := strings.Builder{}
+	for isDigit(l.ch) || isLetter(l.ch) {
+		out.WriteByte(l.ch)
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return out.String()
 }
 
 func (l *Lexer) readIdentifier() string {
-	position := l.position
+	out := strings.Builder{}
 	for isLetter(l.ch) {
+		out.WriteByte(l.ch)
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return out.String()
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readStringPart reads a string literal up to its closing quote, or up to
+// the ${ that starts an interpolated expression. It starts on the opening
+// quote, or on the } that ends an expression when head is false.
+//
+// Within strings \$ stands for a $ that doesn't start an expression, \"
+// for a quote and \\ for a single backslash. Any other backslash is kept
+// as it is, with the character after it: "a\b" and "\n" are three and two
+// characters long.
+func (l *Lexer) readStringPart(head bool) token.Token {
+	out := strings.Builder{}
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch {
+		case l.ch == '"' || l.ch == 0:
+			if head {
+				return token.Token{Type: token.STRING, Literal: out.String()}
+			}
+			return token.Token{Type: token.STRING_TAIL, Literal: out.String()}
+		case l.ch == '\\' && changedEscapes[l.peekAhead()] != "":
+			if l.warnEscapes {
+				pos := token.Position{Line: l.line, Column: l.column}
+				l.warnings = append(l.warnings, pos.String()+": "+changedEscapes[l.peekAhead()])
+			}
+			l.readChar()
+		case l.ch == '$' && l.peekAhead() == '{':
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			if head {
+				return token.Token{Type: token.STRING_HEAD, Literal: out.String()}
+			}
+			return token.Token{Type: token.STRING_MID, Literal: out.String()}
 		}
+		out.WriteByte(l.ch)
 	}
-	return l.input[position:l.position]
+}
+
+// changedEscapes are the escapes of strings, with the warning for each
+// about what it meant before strings had escapes.
+var changedEscapes = map[byte]string{
+	'$':  `\$ stands for $ now; before strings had escapes it was \$, which is written \\$ now`,
+	'"':  `\" stands for a quote now; before strings had escapes it was a backslash ending the string, which is written \\" now`,
+	'\\': `\\ stands for one backslash now; before strings had escapes it was two, which are written \\\\ now`,
 }
 
 func isLetter(ch byte) bool {
@@ -137,19 +347,43 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// twoCharToken consumes the current and the next character as a single
+// token of the given type.
+func (l *Lexer) twoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	ch, err := l.r.ReadByte()
+	if err != nil {
+		if err != io.EOF && l.err == nil {
+			l.err = err
+		}
+		ch = 0
+	}
+	l.ch = ch
+
+	// Continuation bytes of a multi-byte UTF-8 character share a column
+	if l.ch&0xC0 != 0x80 {
+		l.column++
 	}
-	l.position = l.readPosition
-	l.readPosition += 1
 }
 
 func (l *Lexer) peekAhead() byte {
-	if l.readPosition >= len(l.input) {
+	return l.peekAheadN(1)
+}
+
+// peekAheadN returns the byte n positions after the current char
+func (l *Lexer) peekAheadN(n int) byte {
+	next, _ := l.r.Peek(n)
+	if len(next) < n {
 		return 0
 	}
-	return l.input[l.readPosition]
+	return next[n-1]
 }
@@ -1,7 +1,11 @@
 package lexer
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"alde.nu/mint/token"
 )
@@ -174,3 +178,400 @@ func Test_NextTokenExtended(t *testing.T) {
 		}
 	}
 }
+
+func Test_NextTokenLogicalOperators(t *testing.T) {
+	input := `a && b || !c & |`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.BANG, "!"},
+		{token.IDENT, "c"},
+		{token.AMPERSAND, "&"},
+		{token.PIPE, "|"},
+		{token.EOF, ""},
+	}
+	l := Create(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func Test_NextTokenPunctuation(t *testing.T) {
+	input := `a?.["b"] ?? null?.(c) ? ... . => match`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.OPTIONAL, "?."},
+		{token.LBRACKET, "["},
+		{token.STRING, "b"},
+		{token.RBRACKET, "]"},
+		{token.NULLISH, "??"},
+		{token.NULL, "null"},
+		{token.OPTIONAL, "?."},
+		{token.LPAREN, "("},
+		{token.IDENT, "c"},
+		{token.RPAREN, ")"},
+		{token.ILLEGAL, "?"},
+		{token.ELLIPSIS, "..."},
+		{token.ILLEGAL, "."},
+		{token.ARROW, "=>"},
+		{token.MATCH, "match"},
+		{token.EOF, ""},
+	}
+	l := Create(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func Test_NextTokenArithmeticOperators(t *testing.T) {
+	input := `a <= b >= c % d ** e & f | g ^ ~h << i >> j < k > l * m`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.POWER, "**"},
+		{token.IDENT, "e"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "f"},
+		{token.PIPE, "|"},
+		{token.IDENT, "g"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "h"},
+		{token.LSHIFT, "<<"},
+		{token.IDENT, "i"},
+		{token.RSHIFT, ">>"},
+		{token.IDENT, "j"},
+		{token.LT, "<"},
+		{token.IDENT, "k"},
+		{token.GT, ">"},
+		{token.IDENT, "l"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "m"},
+		{token.EOF, ""},
+	}
+	l := Create(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func Test_NextTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  "åäö" == y;
+`
+	tests := []struct {
+		expectedType token.TokenType
+		line         int
+		column       int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.STRING, 2, 3},
+		{token.EQ, 2, 9},
+		{token.IDENT, 2, 12},
+		{token.SEMICOLON, 2, 13},
+		{token.EOF, 3, 1},
+	}
+	l := Create(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%s",
+				i, tt.line, tt.column, tok.Pos)
+		}
+	}
+}
+
+func Test_StartAtLine(t *testing.T) {
+	l := Create("x\ny")
+	l.StartAtLine(5)
+
+	for _, line := range []int{5, 6} {
+		if tok := l.NextToken(); tok.Pos.Line != line {
+			t.Fatalf("wrong line for %q. expected=%d, got=%d", tok.Literal, line, tok.Pos.Line)
+		}
+	}
+}
+
+func Test_NextTokenSkipsComments(t *testing.T) {
+	input := `// leading
+let x = 10 / 2; // trailing
+// one
+  // two
+x`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+	l := Create(input)
+	l.KeepComments()
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "// leading", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.COMMENT, Literal: "// trailing", Pos: token.Position{Line: 2, Column: 17}},
+		{Type: token.COMMENT, Literal: "// one", Pos: token.Position{Line: 3, Column: 1}},
+		{Type: token.COMMENT, Literal: "// two", Pos: token.Position{Line: 4, Column: 3}},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expected), len(comments))
+	}
+	for i, comment := range comments {
+		if comment != expected[i] {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected[i], comment)
+		}
+	}
+}
+
+func Test_CommentsDroppedByDefault(t *testing.T) {
+	l := Create("// one\nx // two\n")
+	if tok := l.NextToken(); tok.Type != token.IDENT || tok.Literal != "x" {
+		t.Fatalf("wrong token. got=%+v", tok)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("wrong token. got=%+v", tok)
+	}
+	if len(l.Comments()) != 0 {
+		t.Errorf("comments kept without KeepComments, got=%+v", l.Comments())
+	}
+}
+
+func Test_CreateFromReader(t *testing.T) {
+	input := `let add = fn(x, y) { x + y; }; // åäö
+let result = add(five, ten) ?? [1, 2][0:1];
+"foo bar" != {"a": ...rest}`
+
+	expected := Create(input)
+	l := CreateFromReader(iotest.OneByteReader(strings.NewReader(input)))
+	l.KeepComments()
+	for i := 0; ; i++ {
+		want := expected.NextToken()
+		got := l.NextToken()
+		if got != want {
+			t.Fatalf("tokens[%d] wrong. expected=%+v, got=%+v", i, want, got)
+		}
+		if got.Type == token.EOF {
+			break
+		}
+	}
+	if len(l.Comments()) != 1 || l.Comments()[0].Literal != "// åäö" {
+		t.Errorf("comments wrong, got=%+v", l.Comments())
+	}
+	if l.Err() != nil {
+		t.Errorf("unexpected error: %s", l.Err())
+	}
+}
+
+func Test_CreateFromReaderError(t *testing.T) {
+	l := CreateFromReader(io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(errors.New("broken pipe"))))
+
+	for _, expected := range []token.TokenType{token.LET, token.IDENT, token.EOF, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("wrong token. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+	if l.Err() == nil || l.Err().Error() != "broken pipe" {
+		t.Errorf("expected the read error, got %v", l.Err())
+	}
+}
+
+func Test_PeekAndUnreadToken(t *testing.T) {
+	l := Create(`a b c d`)
+
+	if tok := l.PeekToken(2); tok.Literal != "c" {
+		t.Fatalf("PeekToken(2) wrong. expected=%q, got=%q", "c", tok.Literal)
+	}
+	if tok := l.PeekToken(0); tok.Literal != "a" {
+		t.Fatalf("PeekToken(0) wrong. expected=%q, got=%q", "a", tok.Literal)
+	}
+
+	a := l.NextToken()
+	b := l.NextToken()
+	l.UnreadToken(b)
+	l.UnreadToken(a)
+	if tok := l.PeekToken(5); tok.Type != token.EOF {
+		t.Fatalf("PeekToken(5) wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	for _, expected := range []string{"a", "b", "c", "d", ""} {
+		if tok := l.NextToken(); tok.Literal != expected {
+			t.Fatalf("wrong token. expected=%q, got=%q", expected, tok.Literal)
+		}
+	}
+}
+
+func Test_NextTokenInterpolatedStrings(t *testing.T) {
+	input := `"a ${x} b ${ {"k": "c ${y}"}["k"] }" "\\${z}" "\${w}" "$"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_HEAD, "a "},
+		{token.IDENT, "x"},
+		{token.STRING_MID, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING_HEAD, "c "},
+		{token.IDENT, "y"},
+		{token.STRING_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.STRING_TAIL, ""},
+		{token.STRING_HEAD, "\\"},
+		{token.IDENT, "z"},
+		{token.STRING_TAIL, ""},
+		{token.STRING, "${w}"},
+		{token.STRING, "$"},
+		{token.EOF, ""},
+	}
+
+	l := Create(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func Test_NextTokenBackslashes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// A single backslash is kept as it is
+		{`"a\b"`, `a\b`},
+		{`"\n"`, `\n`},
+		{`"a\ b"`, `a\ b`},
+		// Two stand for one, which changes literals written before \\
+		// was an escape: "C:\\dir" used to be C:\\dir
+		{`"C:\\dir"`, `C:\dir`},
+		{`"\\\\"`, `\\`},
+		{`"\$"`, `$`},
+		// \" is a quote, where it used to end the string
+		{`"say \"hi\""`, `say "hi"`},
+		{`"\\"`, `\`},
+		{`"\\\""`, `\"`},
+		{`"\"`, `"`},
+	}
+
+	for _, tt := range tests {
+		tok := Create(tt.input).NextToken()
+		if tok.Type != token.STRING || tok.Literal != tt.expected {
+			t.Errorf("%s - wrong token. expected=STRING %q, got=%q %q", tt.input, tt.expected, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func Test_ChangedEscapeWarnings(t *testing.T) {
+	input := "\"C:\\\\dir\" \"a\\b\";\n\"say \\\"hi\\\"\" \"\\${x}\""
+
+	l := Create(input)
+	l.WarnChangedEscapes()
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	expected := []string{
+		`1:4: \\ stands for one backslash now; before strings had escapes it was two, which are written \\\\ now`,
+		`2:6: \" stands for a quote now; before strings had escapes it was a backslash ending the string, which is written \\" now`,
+		`2:10: \" stands for a quote now; before strings had escapes it was a backslash ending the string, which is written \\" now`,
+		`2:15: \$ stands for $ now; before strings had escapes it was \$, which is written \\$ now`,
+	}
+	warnings := l.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("wrong number of warnings. want=%d, got=%d (%q)", len(expected), len(warnings), warnings)
+	}
+	for i, want := range expected {
+		if warnings[i] != want {
+			t.Errorf("warnings[%d] wrong.\nwant=%q\ngot= %q", i, want, warnings[i])
+		}
+	}
+
+	if warnings := Create(input).Warnings(); len(warnings) != 0 {
+		t.Errorf("warnings without WarnChangedEscapes: %q", warnings)
+	}
+}
+
+func Test_NextTokenNumbers(t *testing.T) {
+	input := `0xFF 0o755 0b1010 1_000_000 0x 1__0 1_ 12ab;`
+	expected := []string{"0xFF", "0o755", "0b1010", "1_000_000", "0x", "1__0", "1_", "12ab"}
+
+	l := Create(input)
+	for i, literal := range expected {
+		tok := l.NextToken()
+		if tok.Type != token.INT || tok.Literal != literal {
+			t.Fatalf("tests[%d] - wrong token. expected=INT %q, got=%q %q", i, literal, tok.Type, tok.Literal)
+		}
+	}
+	if tok := l.NextToken(); tok.Type != token.SEMICOLON {
+		t.Fatalf("wrong token after the numbers. expected=%q, got=%q", token.SEMICOLON, tok.Type)
+	}
+}
@@ -9,6 +9,19 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "tokens":
+			os.Exit(runTokens(os.Args[2:]))
+		case "ast":
+			os.Exit(runAST(os.Args[2:]))
+		case "run":
+			os.Exit(runRun(os.Args[2:]))
+		}
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
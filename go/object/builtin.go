@@ -4,6 +4,10 @@ type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// ReturnsArgument is set for builtins that return one of their
+	// arguments, or a part of one, rather than a value they built. The
+	// engines count the values builtins build against the memory limit.
+	ReturnsArgument bool
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
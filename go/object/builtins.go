@@ -0,0 +1,205 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builtins is shared by the evaluator and the VM. The compiler refers to
+// builtins by their index, so new ones have to be added at the end.
+//
+// A builtin returns nil when it has nothing to return, leaving it to the
+// caller to turn that into its own null value.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{"len", &Builtin{Fn: lengthFn}},
+	{"type", &Builtin{Fn: typeFn}},
+	{"first", &Builtin{Fn: firstFn, ReturnsArgument: true}},
+	{"last", &Builtin{Fn: lastFn, ReturnsArgument: true}},
+	{"rest", &Builtin{Fn: restFn}},
+	{"push", &Builtin{Fn: pushFn}},
+	{"puts", &Builtin{Fn: putsFn}},
+	{"equal_fold", &Builtin{Fn: equalFoldFn}},
+	{"lower", &Builtin{Fn: lowerFn}},
+	{"upper", &Builtin{Fn: upperFn}},
+	{"keys", &Builtin{Fn: keysFn}},
+	{"values", &Builtin{Fn: valuesFn}},
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func lengthFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments to `len`. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *String:
+		// Characters rather than bytes, to agree with indexing
+		return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+	default:
+		return NewError(TypeError, "argument to `len` not supported, got %s", args[0].Type())
+	}
+}
+
+func typeFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments to `type`. got=%d, want=1", len(args))
+	}
+
+	return &String{Value: string(args[0].Type())}
+}
+
+func firstFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return NewError(TypeError, "argument to `first` must be ARRAY, got %s", args[0].Type())
+	}
+	arr := args[0].(*Array)
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+	return nil
+}
+
+func lastFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return NewError(TypeError, "argument to `last` must be ARRAY, got %s", args[0].Type())
+	}
+	arr := args[0].(*Array)
+	length := len(arr.Elements)
+	if length > 0 {
+		return arr.Elements[length-1]
+	}
+	return nil
+}
+
+func restFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return NewError(TypeError, "argument to `rest` must be ARRAY, got %s", args[0].Type())
+	}
+	arr := args[0].(*Array)
+	length := len(arr.Elements)
+	if length > 0 {
+		newElements := make([]Object, length-1)
+		copy(newElements, arr.Elements[1:length])
+		return &Array{Elements: newElements}
+	}
+	return nil
+}
+
+func pushFn(args ...Object) Object {
+	if len(args) != 2 {
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return NewError(TypeError, "argument to `rest` must be ARRAY, got %s", args[0].Type())
+	}
+	arr := args[0].(*Array)
+	length := len(arr.Elements)
+
+	newElements := make([]Object, length+1)
+	copy(newElements, arr.Elements)
+	newElements[length] = args[1]
+	return &Array{Elements: newElements}
+}
+
+func putsFn(args ...Object) Object {
+	for _, arg := range args {
+		fmt.Println(arg.Inspect())
+	}
+
+	return nil
+}
+
+func equalFoldFn(args ...Object) Object {
+	if len(args) != 2 {
+		return NewError(TypeError, "wrong number of arguments to `equal_fold`. got=%d, want=2", len(args))
+	}
+	left, ok := args[0].(*String)
+	if !ok {
+		return NewError(TypeError, "argument to `equal_fold` must be STRING, got %s", args[0].Type())
+	}
+	right, ok := args[1].(*String)
+	if !ok {
+		return NewError(TypeError, "argument to `equal_fold` must be STRING, got %s", args[1].Type())
+	}
+
+	return NativeBool(strings.EqualFold(left.Value, right.Value))
+}
+
+func lowerFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments to `lower`. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return NewError(TypeError, "argument to `lower` must be STRING, got %s", args[0].Type())
+	}
+
+	return &String{Value: strings.ToLower(str.Value)}
+}
+
+func upperFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments to `upper`. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return NewError(TypeError, "argument to `upper` must be STRING, got %s", args[0].Type())
+	}
+
+	return &String{Value: strings.ToUpper(str.Value)}
+}
+
+func keysFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments to `keys`. got=%d, want=1", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return NewError(TypeError, "argument to `keys` must be HASH, got %s", args[0].Type())
+	}
+
+	keys := make([]Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		keys = append(keys, pair.Key)
+	}
+	return &Array{Elements: keys}
+}
+
+func valuesFn(args ...Object) Object {
+	if len(args) != 1 {
+		return NewError(TypeError, "wrong number of arguments to `values`. got=%d, want=1", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return NewError(TypeError, "argument to `values` must be HASH, got %s", args[0].Type())
+	}
+
+	values := make([]Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		values = append(values, pair.Value)
+	}
+	return &Array{Elements: values}
+}
@@ -0,0 +1,70 @@
+package object
+
+// Shape checks for destructuring let, shared by the evaluator and the VM so
+// both report mismatches the same way.
+
+// DestructureArray returns the first n elements of value for an array
+// pattern. With rest set, the remaining elements follow as one more Array.
+// Without it, value must have exactly n elements.
+func DestructureArray(value Object, n int, rest bool) ([]Object, *Error) {
+	arr, ok := value.(*Array)
+	if !ok {
+		return nil, NewError(PatternError, "cannot destructure %s with an array pattern", value.Type())
+	}
+
+	length := len(arr.Elements)
+	if rest && length < n {
+		return nil, NewError(PatternError, "array pattern needs at least %d elements, got %d", n, length)
+	}
+	if !rest && length != n {
+		return nil, NewError(PatternError, "array pattern needs %d elements, got %d", n, length)
+	}
+
+	values := make([]Object, n, n+1)
+	copy(values, arr.Elements)
+	if rest {
+		remaining := make([]Object, length-n)
+		copy(remaining, arr.Elements[n:])
+		values = append(values, &Array{Elements: remaining})
+	}
+	return values, nil
+}
+
+// DestructureHash returns the values stored under keys for a hash pattern.
+// With rest set, the pairs that weren't named follow as one more Hash.
+// Every key has to be present.
+func DestructureHash(value Object, keys []string, rest bool) ([]Object, *Error) {
+	hash, ok := value.(*Hash)
+	if !ok {
+		return nil, NewError(PatternError, "cannot destructure %s with a hash pattern", value.Type())
+	}
+
+	values := make([]Object, 0, len(keys)+1)
+	named := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		v, ok := hash.Get(&String{Value: key})
+		if !ok {
+			return nil, NewError(PatternError, "hash pattern key %q not found", key)
+		}
+		values = append(values, v)
+		named[key] = true
+	}
+
+	if rest {
+		values = append(values, unnamedPairs(hash, named))
+	}
+	return values, nil
+}
+
+// unnamedPairs returns a Hash of the pairs whose keys aren't strings in
+// named, for the ...rest of a hash pattern.
+func unnamedPairs(hash *Hash, named map[string]bool) *Hash {
+	remaining := NewHash()
+	for _, pair := range hash.Pairs() {
+		if key, ok := pair.Key.(*String); ok && named[key.Value] {
+			continue
+		}
+		remaining.Set(pair.Key, pair.Value)
+	}
+	return remaining
+}
@@ -0,0 +1,98 @@
+package object
+
+// Equals reports whether a and b are the same value. Arrays and hashes
+// are compared structurally, element by element, while functions and
+// builtins are only equal to themselves. Values of different types are
+// never equal.
+func Equals(a, b Object) bool {
+	return equals(a, b, nil)
+}
+
+// visit is a pair of collections that is being compared further up the
+// call stack. Meeting it again means the collections are cyclic and, as
+// nothing has proved them different yet, they are taken to be equal. The
+// map of visits is only made once there are collections to compare.
+type visit struct {
+	a, b Object
+}
+
+func equals(a, b Object, visited map[visit]bool) bool {
+	if a == b {
+		return true
+	}
+	// A function with an empty body gives no value at all in the
+	// evaluator, which counts as null
+	if a == nil || b == nil {
+		return isNullish(a) && isNullish(b)
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Null:
+		return true
+	case *Array:
+		return arrayEquals(a, b.(*Array), visited)
+	case *Hash:
+		return hashEquals(a, b.(*Hash), visited)
+	default:
+		// Functions, closures, builtins and errors have identity only
+		return false
+	}
+}
+
+func arrayEquals(a, b *Array, visited map[visit]bool) bool {
+	if len(a.Elements) != len(b.Elements) {
+		return false
+	}
+
+	v := visit{a, b}
+	if visited[v] {
+		return true
+	}
+	if visited == nil {
+		visited = make(map[visit]bool)
+	}
+	visited[v] = true
+
+	for i := range a.Elements {
+		if !equals(a.Elements[i], b.Elements[i], visited) {
+			return false
+		}
+	}
+	return true
+}
+
+func hashEquals(a, b *Hash, visited map[visit]bool) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+
+	v := visit{a, b}
+	if visited[v] {
+		return true
+	}
+	if visited == nil {
+		visited = make(map[visit]bool)
+	}
+	visited[v] = true
+
+	for _, pair := range a.Pairs() {
+		other, ok := b.Get(pair.Key)
+		if !ok || !equals(pair.Value, other, visited) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNullish(obj Object) bool {
+	return obj == nil || obj.Type() == NULL_OBJ
+}
@@ -0,0 +1,76 @@
+package object
+
+import "testing"
+
+func Test_Equals(t *testing.T) {
+	fn := &Builtin{Fn: lengthFn}
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	a := &String{Value: "a"}
+
+	testData := []struct {
+		left, right Object
+		expected    bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, two, false},
+		{&String{Value: "a"}, a, true},
+		{&String{Value: "A"}, a, false},
+		{one, &String{Value: "1"}, false},
+		{&Boolean{Value: true}, &Boolean{Value: true}, true},
+		{&Null{}, &Null{}, true},
+		{&Array{Elements: []Object{one, a}}, &Array{Elements: []Object{one, a}}, true},
+		{&Array{Elements: []Object{one, a}}, &Array{Elements: []Object{a, one}}, false},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{one, one}}, false},
+		{&Array{Elements: []Object{&Array{Elements: []Object{one}}}}, &Array{Elements: []Object{&Array{Elements: []Object{one}}}}, true},
+		{hash(a, one, one, two), hash(one, two, a, one), true},
+		{hash(a, one), hash(a, two), false},
+		{hash(a, one), hash(one, one), false},
+		{hash(a, &Array{Elements: []Object{one}}), hash(a, &Array{Elements: []Object{one}}), true},
+		{fn, fn, true},
+		{fn, &Builtin{Fn: lengthFn}, false},
+		{&Closure{Fn: &CompiledFunction{}}, &Closure{Fn: &CompiledFunction{}}, false},
+		{nil, one, false},
+		{one, nil, false},
+		{nil, &Null{}, true},
+	}
+
+	for i, tt := range testData {
+		if got := Equals(tt.left, tt.right); got != tt.expected {
+			t.Errorf("tests[%d] - Equals(%s, %s) wrong. want=%t, got=%t",
+				i, tt.left.Inspect(), tt.right.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func Test_EqualsAllocations(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	if allocs := testing.AllocsPerRun(100, func() { Equals(one, two) }); allocs != 0 {
+		t.Errorf("comparing integers allocates %v times", allocs)
+	}
+}
+
+func Test_EqualsCyclic(t *testing.T) {
+	left := &Array{Elements: []Object{&Integer{Value: 1}, nil}}
+	left.Elements[1] = left
+	right := &Array{Elements: []Object{&Integer{Value: 1}, nil}}
+	right.Elements[1] = right
+
+	if !Equals(left, right) {
+		t.Errorf("identically shaped cyclic arrays are not equal")
+	}
+
+	other := &Array{Elements: []Object{&Integer{Value: 2}, nil}}
+	other.Elements[1] = other
+	if Equals(left, other) {
+		t.Errorf("cyclic arrays with different elements are equal")
+	}
+}
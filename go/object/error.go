@@ -1,8 +1,180 @@
 package object
 
+import (
+	"fmt"
+	"strings"
+
+	"alde.nu/mint/token"
+)
+
+// Error is a runtime error or a thrown value on its way up to the nearest
+// catch. Runtime errors get their Kind where they are raised.
 type Error struct {
 	Message string
+	Kind    string
+	Pos     token.Position // where it is in the function it has reached
+	Stack   []StackFrame   // the functions it was thrown through, innermost first
+	Omitted int            // how many more it was thrown through, see MaxStackFrames
+	Value   Object         // the value that was thrown, nil for runtime errors
+}
+
+// The kinds of errors, which a catch finds under "kind". Values thrown
+// without a kind of their own are plain errors.
+const (
+	PlainError      = "Error"
+	NameError       = "NameError"
+	TypeError       = "TypeError"
+	ArithmeticError = "ArithmeticError"
+	PatternError    = "PatternError"
+	RecursionError  = "RecursionError"
+)
+
+// NewError makes a runtime error of kind, with a formatted message.
+func NewError(kind string, format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Kind: kind}
+}
+
+// StackFrame is a function an error was thrown through, with the position
+// it was thrown from: the failing expression in the innermost function and
+// the call to the next function in the others.
+type StackFrame struct {
+	Function string
+	Pos      token.Position
+}
+
+// String is the function with the position, like "f (2:5)", or only the
+// function when the position isn't known.
+func (f StackFrame) String() string {
+	if f.Pos.Line == 0 {
+		return f.Function
+	}
+	return fmt.Sprintf("%s (%s)", f.Function, f.Pos)
+}
+
+// parseStackFrame reads a frame back from its String.
+func parseStackFrame(s string) StackFrame {
+	var pos token.Position
+	open := strings.LastIndex(s, " (")
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return StackFrame{Function: s}
+	}
+	if _, err := fmt.Sscanf(s[open+2:], "%d:%d)", &pos.Line, &pos.Column); err != nil {
+		return StackFrame{Function: s}
+	}
+	return StackFrame{Function: s[:open], Pos: pos}
 }
 
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
+
+// Error lets the VM return an Error as a Go error.
+func (e *Error) Error() string { return e.Message }
+
+// AnonymousFunction names functions in the stack that weren't bound with
+// let, and MainFunction the program itself.
+const (
+	AnonymousFunction = "<anonymous>"
+	MainFunction      = "<main>"
+)
+
+// MaxStackFrames is how many functions an error's stack keeps. Past that
+// they are only counted, so running out of call depth doesn't come with a
+// trace a thousand frames long.
+const MaxStackFrames = 32
+
+// RecursionMessage is the message of the error both engines raise when a
+// call would go deeper than they are configured to allow.
+const RecursionMessage = "maximum recursion depth exceeded"
+
+// NewRecursionError makes the error raised for a call past the limit.
+func NewRecursionError() *Error {
+	return &Error{Message: RecursionMessage, Kind: RecursionError}
+}
+
+// Locate sets the position of an error that doesn't have one yet, which
+// makes the first position given the one it was raised at.
+func (e *Error) Locate(pos token.Position) {
+	if e.Pos.Line == 0 {
+		e.Pos = pos
+	}
+}
+
+// Unwind records that the error left function, which was called from the
+// position call in the function it reaches.
+func (e *Error) Unwind(function string, call token.Position) {
+	if function == "" {
+		function = AnonymousFunction
+	}
+	if len(e.Stack) < MaxStackFrames {
+		e.Stack = append(e.Stack, StackFrame{Function: function, Pos: e.Pos})
+	} else {
+		e.Omitted++
+	}
+	e.Pos = call
+}
+
+// Trace is the stack of an error that reached the program, ending with the
+// program itself.
+func (e *Error) Trace() []StackFrame {
+	return append(e.Stack[:len(e.Stack):len(e.Stack)], StackFrame{Function: MainFunction, Pos: e.Pos})
+}
+
+// Thrown is the error `throw value` raises, which a catch gets value back
+// from unchanged. A hash sets the "message", "kind" and "stack" of the
+// error with those keys, which is also how a caught error is thrown again;
+// without a "message" the hash itself is shown. Other values are shown as
+// the message.
+func Thrown(value Object) *Error {
+	hash, ok := value.(*Hash)
+	if !ok {
+		return &Error{Message: inspectMessage(value), Kind: PlainError, Value: value}
+	}
+
+	err := &Error{Message: hash.Inspect(), Kind: PlainError, Value: hash}
+	if message, ok := hash.Get(&String{Value: "message"}); ok {
+		err.Message = inspectMessage(message)
+	}
+	if kind, ok := hash.Get(&String{Value: "kind"}); ok {
+		err.Kind = inspectMessage(kind)
+	}
+	if stack, ok := hash.Get(&String{Value: "stack"}); ok {
+		if stack, ok := stack.(*Array); ok {
+			for _, el := range stack.Elements {
+				err.Stack = append(err.Stack, parseStackFrame(inspectMessage(el)))
+			}
+		}
+	}
+	return err
+}
+
+func inspectMessage(obj Object) string {
+	if str, ok := obj.(*String); ok {
+		return str.Value
+	}
+	return obj.Inspect()
+}
+
+// Caught is the value a catch binds for e. A thrown value is caught as it
+// was thrown. A runtime error is caught as a hash with its "message",
+// "kind" and "stack", the functions it left as in "f (2:5)", innermost
+// first.
+func (e *Error) Caught() Object {
+	if e.Value != nil {
+		return e.Value
+	}
+
+	kind := e.Kind
+	if kind == "" {
+		kind = PlainError
+	}
+	stack := make([]Object, len(e.Stack))
+	for i, frame := range e.Stack {
+		stack[i] = &String{Value: frame.String()}
+	}
+
+	hash := NewHash()
+	hash.Set(&String{Value: "message"}, &String{Value: e.Message})
+	hash.Set(&String{Value: "kind"}, &String{Value: kind})
+	hash.Set(&String{Value: "stack"}, &Array{Elements: stack})
+	return hash
+}
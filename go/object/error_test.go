@@ -0,0 +1,95 @@
+package object
+
+import (
+	"testing"
+
+	"alde.nu/mint/token"
+)
+
+func Test_Caught(t *testing.T) {
+	inner := NewError(ArithmeticError, "division by zero: 1 / 0")
+	inner.Unwind("f", token.Position{Line: 2, Column: 5})
+	inner.Unwind("", token.Position{Line: 3, Column: 1})
+
+	testData := []struct {
+		err      *Error
+		expected map[string]string // the caught pairs, inspected
+	}{
+		{
+			NewError(TypeError, "type mismatch: INTEGER + BOOLEAN"),
+			map[string]string{"message": "type mismatch: INTEGER + BOOLEAN", "kind": "TypeError", "stack": "[]"},
+		},
+		{
+			&Error{Message: "boom"},
+			map[string]string{"message": "boom", "kind": "Error", "stack": "[]"},
+		},
+		{
+			inner,
+			map[string]string{"message": "division by zero: 1 / 0", "kind": "ArithmeticError", "stack": "[f, <anonymous> (2:5)]"},
+		},
+	}
+
+	for _, tt := range testData {
+		caught, ok := tt.err.Caught().(*Hash)
+		if !ok {
+			t.Errorf("%s: not caught as a hash. got=%T", tt.err.Message, tt.err.Caught())
+			continue
+		}
+		if caught.Len() != len(tt.expected) {
+			t.Errorf("%s: wrong pairs. want=%v, got=%s", tt.err.Message, tt.expected, caught.Inspect())
+			continue
+		}
+		for key, want := range tt.expected {
+			value, ok := caught.Get(&String{Value: key})
+			if !ok || inspectMessage(value) != want {
+				t.Errorf("%s: wrong %q. want=%s, got=%v", tt.err.Message, key, want, value)
+			}
+		}
+	}
+}
+
+func Test_CaughtThrownValue(t *testing.T) {
+	code := NewHash()
+	code.Set(&String{Value: "code"}, &Integer{Value: 2})
+
+	for _, value := range []Object{&Integer{Value: 1}, &String{Value: "oops"}, code} {
+		if caught := Thrown(value).Caught(); caught != value {
+			t.Errorf("%s: not caught as thrown. got=%s", value.Inspect(), caught.Inspect())
+		}
+	}
+}
+
+func Test_ThrownHashMessage(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "code"}, &Integer{Value: 2})
+	if err := Thrown(hash); err.Message != "{code: 2}" {
+		t.Errorf("wrong message. want=%q, got=%q", "{code: 2}", err.Message)
+	}
+}
+
+func Test_ThrowCaughtAgain(t *testing.T) {
+	err := NewError(ArithmeticError, "division by zero: 1 / 0")
+	err.Stack = []StackFrame{{Function: "f", Pos: token.Position{Line: 2, Column: 5}}, {Function: "g"}}
+
+	again := Thrown(err.Caught())
+	if again.Message != err.Message || again.Kind != "ArithmeticError" {
+		t.Errorf("wrong error. want=%q ArithmeticError, got=%q %s", err.Message, again.Message, again.Kind)
+	}
+	if len(again.Stack) != 2 || again.Stack[0] != err.Stack[0] || again.Stack[1] != err.Stack[1] {
+		t.Errorf("wrong stack. want=%v, got=%v", err.Stack, again.Stack)
+	}
+}
+
+func Test_UnwindTruncatesStack(t *testing.T) {
+	err := &Error{Message: "boom"}
+	for i := 0; i < MaxStackFrames+10; i++ {
+		err.Unwind("f", token.Position{Line: 1, Column: i + 1})
+	}
+
+	if len(err.Stack) != MaxStackFrames || err.Omitted != 10 {
+		t.Errorf("wrong stack. want %d frames and 10 omitted, got %d and %d", MaxStackFrames, len(err.Stack), err.Omitted)
+	}
+	if pos := err.Trace()[MaxStackFrames].Pos; pos.Column != MaxStackFrames+10 {
+		t.Errorf("wrong position of <main>. want=1:%d, got=%s", MaxStackFrames+10, pos)
+	}
+}
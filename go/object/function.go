@@ -10,6 +10,7 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // set when the function is bound with let
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -9,8 +9,17 @@ type HashPair struct {
 	Key   Object
 	Value Object
 }
+
+// Hash keeps its pairs in insertion order, with an index bucketed by
+// HashKey for lookups. Different keys can share a HashKey, so lookups
+// always compare the actual keys within a bucket.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs   []HashPair
+	buckets map[HashKey][]int // positions in pairs
+}
+
+func NewHash() *Hash {
+	return &Hash{buckets: make(map[HashKey][]int)}
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -18,7 +27,7 @@ func (h *Hash) Inspect() string {
 	out := strings.Builder{}
 	pairs := []string{}
 
-	for _, pair := range h.Pairs {
+	for _, pair := range h.pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -28,3 +37,63 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+// Len returns the number of pairs in the hash.
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// Pairs returns every pair in the hash, in the order the keys were first
+// inserted. The returned slice must not be modified.
+func (h *Hash) Pairs() []HashPair { return h.pairs }
+
+// Get returns the value stored under key. ok is false if there is no such
+// key, or if key can't be used as a hash key at all.
+func (h *Hash) Get(key Object) (value Object, ok bool) {
+	hashKey, ok := HashKeyOf(key)
+	if !ok {
+		return nil, false
+	}
+	return h.GetHashed(hashKey, key)
+}
+
+// GetHashed is Get for callers that already know the HashKey of key.
+func (h *Hash) GetHashed(hashKey HashKey, key Object) (Object, bool) {
+	if i, ok := h.find(hashKey, key); ok {
+		return h.pairs[i].Value, true
+	}
+	return nil, false
+}
+
+// Set stores value under key. A key that is already present keeps its
+// position and only has its value replaced. It returns false if key can't
+// be used as a hash key.
+func (h *Hash) Set(key, value Object) bool {
+	hashKey, ok := HashKeyOf(key)
+	if !ok {
+		return false
+	}
+	h.SetHashed(hashKey, key, value)
+	return true
+}
+
+// SetHashed is Set for callers that already know the HashKey of key.
+func (h *Hash) SetHashed(hashKey HashKey, key, value Object) {
+	if i, ok := h.find(hashKey, key); ok {
+		h.pairs[i].Value = value
+		return
+	}
+
+	if h.buckets == nil {
+		h.buckets = make(map[HashKey][]int)
+	}
+	h.buckets[hashKey] = append(h.buckets[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+func (h *Hash) find(hashKey HashKey, key Object) (int, bool) {
+	for _, i := range h.buckets[hashKey] {
+		if Equals(h.pairs[i].Key, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
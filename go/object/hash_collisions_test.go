@@ -0,0 +1,38 @@
+package object
+
+import (
+	"testing"
+
+	"alde.nu/mint/internal/hashtest"
+)
+
+func Test_HashForcedCollisions(t *testing.T) {
+	restore := hashtest.ForceCollisions()
+	defer restore()
+
+	keys := []Object{
+		&String{Value: "a"},
+		&String{Value: "b"},
+		&Integer{Value: 1},
+		&Boolean{Value: true},
+		&Array{Elements: []Object{&Integer{Value: 1}}},
+	}
+
+	h := NewHash()
+	for i, key := range keys {
+		h.Set(key, &Integer{Value: int64(i)})
+	}
+
+	if h.Len() != len(keys) {
+		t.Fatalf("colliding keys overwrote each other. want=%d pairs, got=%d", len(keys), h.Len())
+	}
+	for i, key := range keys {
+		value, ok := h.Get(key)
+		if !ok || !Equals(value, &Integer{Value: int64(i)}) {
+			t.Errorf("wrong value for %s. want=%d, got=%v", key.Inspect(), i, value)
+		}
+	}
+	if _, ok := h.Get(&String{Value: "c"}); ok {
+		t.Errorf("hash has value for missing colliding key \"c\"")
+	}
+}
@@ -0,0 +1,83 @@
+package object
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+
+	"alde.nu/mint/internal/hashtest"
+)
+
+// HashKeyOf returns the hash key of obj, and whether obj can be used as a
+// hash key at all. Arrays and hashes can only be used when everything they
+// contain can.
+func HashKeyOf(obj Object) (HashKey, bool) {
+	var key HashKey
+	var ok bool
+
+	switch obj := obj.(type) {
+	case *Array:
+		key, ok = obj.hashKey()
+	case *Hash:
+		key, ok = obj.hashKey()
+	case Hashable:
+		key, ok = obj.HashKey(), true
+	}
+
+	if ok && hashtest.Colliding {
+		return HashKey{}, true
+	}
+	return key, ok
+}
+
+// HashKey is derived from the elements, so equal arrays get equal keys.
+// Prefer HashKeyOf, which also reports arrays holding unhashable values.
+func (ao *Array) HashKey() HashKey {
+	key, _ := ao.hashKey()
+	return key
+}
+
+func (ao *Array) hashKey() (HashKey, bool) {
+	h := fnv.New64a()
+	for _, el := range ao.Elements {
+		key, ok := HashKeyOf(el)
+		if !ok {
+			return HashKey{}, false
+		}
+		writeHashKey(h, key)
+	}
+	return HashKey{Type: ao.Type(), Value: h.Sum64()}, true
+}
+
+// HashKey is derived from the pairs regardless of their order, so equal
+// hashes get equal keys. Prefer HashKeyOf, which also reports hashes
+// holding unhashable values.
+func (h *Hash) HashKey() HashKey {
+	key, _ := h.hashKey()
+	return key
+}
+
+func (h *Hash) hashKey() (HashKey, bool) {
+	var sum uint64
+	for keyHash, bucket := range h.buckets {
+		for _, i := range bucket {
+			valueHash, ok := HashKeyOf(h.pairs[i].Value)
+			if !ok {
+				return HashKey{}, false
+			}
+
+			pairHash := fnv.New64a()
+			writeHashKey(pairHash, keyHash)
+			writeHashKey(pairHash, valueHash)
+			// Addition keeps the key independent of insertion order
+			sum += pairHash.Sum64()
+		}
+	}
+	return HashKey{Type: h.Type(), Value: sum}, true
+}
+
+func writeHashKey(w interface{ Write([]byte) (int, error) }, key HashKey) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], key.Value)
+	w.Write([]byte(key.Type))
+	w.Write(buf[:])
+}
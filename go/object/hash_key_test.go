@@ -18,3 +18,67 @@ func Test_StringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have the same hash keys")
 	}
 }
+
+func Test_CompositeHashKey(t *testing.T) {
+	pair := func(k, v Object) HashPair { return HashPair{Key: k, Value: v} }
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	str := &String{Value: "a"}
+
+	hashOf := func(pairs ...HashPair) *Hash {
+		h := NewHash()
+		for _, p := range pairs {
+			h.Set(p.Key, p.Value)
+		}
+		return h
+	}
+
+	testData := []struct {
+		a, b  Object
+		equal bool
+	}{
+		{&Array{Elements: []Object{one, two}}, &Array{Elements: []Object{one, two}}, true},
+		{&Array{Elements: []Object{one, two}}, &Array{Elements: []Object{two, one}}, false},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{one, one}}, false},
+		{&Array{Elements: []Object{&Array{Elements: []Object{one}}, two}},
+			&Array{Elements: []Object{one, two}}, false},
+		{&Array{}, NewHash(), false},
+		{hashOf(pair(one, str), pair(str, two)), hashOf(pair(str, two), pair(one, str)), true},
+		{hashOf(pair(one, two)), hashOf(pair(two, one)), false},
+		{hashOf(pair(one, two)), hashOf(pair(one, one)), false},
+	}
+
+	for i, tt := range testData {
+		a, ok := HashKeyOf(tt.a)
+		if !ok {
+			t.Fatalf("[%d] %s is not hashable", i, tt.a.Inspect())
+		}
+		b, ok := HashKeyOf(tt.b)
+		if !ok {
+			t.Fatalf("[%d] %s is not hashable", i, tt.b.Inspect())
+		}
+		if (a == b) != tt.equal {
+			t.Errorf("[%d] hash keys of %s and %s equal=%t, want %t",
+				i, tt.a.Inspect(), tt.b.Inspect(), a == b, tt.equal)
+		}
+	}
+}
+
+func Test_UnhashableCompositeKey(t *testing.T) {
+	fn := &Builtin{}
+	hash := NewHash()
+	hash.Set(&String{Value: "f"}, fn)
+
+	testData := []Object{
+		fn,
+		&Array{Elements: []Object{&Integer{Value: 1}, fn}},
+		&Array{Elements: []Object{&Array{Elements: []Object{fn}}}},
+		hash,
+	}
+
+	for _, obj := range testData {
+		if _, ok := HashKeyOf(obj); ok {
+			t.Errorf("%s should not be hashable", obj.Inspect())
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package object
+
+import "testing"
+
+func Test_HashSetGet(t *testing.T) {
+	h := NewHash()
+	one := &Integer{Value: 1}
+
+	if !h.Set(&String{Value: "a"}, one) {
+		t.Fatalf("string key is unusable")
+	}
+	if h.Set(&Builtin{}, one) {
+		t.Errorf("builtin key is usable")
+	}
+	h.Set(&String{Value: "a"}, &Integer{Value: 2})
+
+	if h.Len() != 1 {
+		t.Errorf("hash has wrong length. want=1, got=%d", h.Len())
+	}
+	value, ok := h.Get(&String{Value: "a"})
+	if !ok || !Equals(value, &Integer{Value: 2}) {
+		t.Errorf("hash has wrong value for \"a\". got=%v", value)
+	}
+	if _, ok := h.Get(&String{Value: "b"}); ok {
+		t.Errorf("hash has value for missing key \"b\"")
+	}
+}
+
+func Test_HashInsertionOrder(t *testing.T) {
+	h := NewHash()
+	for _, key := range []string{"c", "a", "b"} {
+		h.Set(&String{Value: key}, &Integer{Value: int64(len(key))})
+	}
+	h.Set(&String{Value: "a"}, &Integer{Value: 10})
+
+	expected := "{c: 1, a: 10, b: 1}"
+	for i := 0; i < 10; i++ {
+		if got := h.Inspect(); got != expected {
+			t.Fatalf("hash.Inspect() wrong. want=%q, got=%q", expected, got)
+		}
+	}
+}
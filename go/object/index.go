@@ -0,0 +1,47 @@
+package object
+
+// Indexing and slicing rules shared by the evaluator and the VM. Negative
+// positions count from the end, so -1 is the last element.
+
+// ElementIndex resolves index against a sequence of the given length. ok is
+// false when the index is out of range.
+func ElementIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+// SliceBounds resolves the bounds of a slice against a sequence of the
+// given length. A nil bound is omitted and defaults to the start or end.
+// Bounds are clamped to the sequence, and a start past the end gives an
+// empty slice, so slicing never fails on the numbers alone.
+func SliceBounds(low, high *int64, length int) (start, end int) {
+	start, end = 0, length
+	if low != nil {
+		start = clampBound(*low, length)
+	}
+	if high != nil {
+		end = clampBound(*high, length)
+	}
+	if start > end {
+		start = end
+	}
+	return start, end
+}
+
+func clampBound(bound int64, length int) int {
+	if bound < 0 {
+		bound += int64(length)
+	}
+	if bound < 0 {
+		return 0
+	}
+	if bound > int64(length) {
+		return length
+	}
+	return int(bound)
+}
@@ -0,0 +1,55 @@
+package object
+
+import "testing"
+
+func Test_ElementIndex(t *testing.T) {
+	testData := []struct {
+		index    int64
+		length   int
+		expected int
+		ok       bool
+	}{
+		{0, 3, 0, true},
+		{2, 3, 2, true},
+		{3, 3, 0, false},
+		{-1, 3, 2, true},
+		{-3, 3, 0, true},
+		{-4, 3, 0, false},
+		{0, 0, 0, false},
+	}
+
+	for _, tt := range testData {
+		got, ok := ElementIndex(tt.index, tt.length)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("ElementIndex(%d, %d) wrong. want=(%d, %t), got=(%d, %t)",
+				tt.index, tt.length, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
+
+func Test_SliceBounds(t *testing.T) {
+	bound := func(i int64) *int64 { return &i }
+
+	testData := []struct {
+		low, high  *int64
+		length     int
+		start, end int
+	}{
+		{nil, nil, 4, 0, 4},
+		{bound(1), bound(3), 4, 1, 3},
+		{bound(-2), nil, 4, 2, 4},
+		{nil, bound(-1), 4, 0, 3},
+		{bound(-10), bound(10), 4, 0, 4},
+		{bound(3), bound(1), 4, 1, 1},
+		{bound(5), nil, 4, 4, 4},
+		{nil, nil, 0, 0, 0},
+	}
+
+	for i, tt := range testData {
+		start, end := SliceBounds(tt.low, tt.high, tt.length)
+		if start != tt.start || end != tt.end {
+			t.Errorf("tests[%d] - SliceBounds wrong. want=[%d:%d], got=[%d:%d]",
+				i, tt.start, tt.end, start, end)
+		}
+	}
+}
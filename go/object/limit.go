@@ -0,0 +1,51 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// LimitError stops a program that ran into a limit it was run with. The
+// program didn't raise it, so unlike an Error it can't be caught, and it
+// tells callers that the program was cut short rather than wrong.
+type LimitError struct {
+	Message string
+	Err     error // the context's error, when it was cancelled or timed out
+}
+
+func (e *LimitError) Inspect() string  { return "ERROR: " + e.Message }
+func (e *LimitError) Type() ObjectType { return ERROR_OBJ }
+func (e *LimitError) Error() string    { return e.Message }
+func (e *LimitError) Unwrap() error    { return e.Err }
+
+// stepCheckInterval is how many steps go by between looks at the context,
+// which is too slow to do at every step.
+const stepCheckInterval = 1024
+
+// Steps counts the steps of a run, which are the nodes the evaluator
+// evaluates or the instructions the VM executes, and stops it after its
+// limit or once its context is done.
+type Steps struct {
+	ctx   context.Context
+	limit int // 0 for no limit
+	taken int
+}
+
+func NewSteps(ctx context.Context, limit int) Steps {
+	return Steps{ctx: ctx, limit: limit}
+}
+
+// Take counts a step, returning the error to stop the run with when it
+// can't be taken.
+func (s *Steps) Take() *LimitError {
+	s.taken++
+	if s.limit > 0 && s.taken > s.limit {
+		return &LimitError{Message: fmt.Sprintf("step limit of %d exceeded", s.limit)}
+	}
+	if s.ctx != nil && s.taken%stepCheckInterval == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return &LimitError{Message: "execution stopped: " + err.Error(), Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package object
+
+import "alde.nu/mint/ast"
+
+// MatchPattern is a match arm's pattern stored as a compiled constant, so
+// the VM can match against it at run time.
+type MatchPattern struct {
+	Pattern ast.Pattern
+}
+
+func (mp *MatchPattern) Type() ObjectType { return MATCH_PATTERN_OBJ }
+func (mp *MatchPattern) Inspect() string  { return mp.Pattern.String() }
+
+// Match reports whether value matches pattern, and returns the values bound
+// to the pattern's identifiers in the order ast.PatternIdentifiers lists
+// them. Unlike destructuring, a value of the wrong shape doesn't match
+// rather than being an error.
+func Match(pattern ast.Pattern, value Object) ([]Object, bool) {
+	bound := []Object{}
+	if !match(pattern, value, &bound) {
+		return nil, false
+	}
+	return bound, true
+}
+
+func match(pattern ast.Pattern, value Object, bound *[]Object) bool {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true
+	case *ast.Identifier:
+		*bound = append(*bound, value)
+		return true
+	case *ast.LiteralPattern:
+		return Equals(literalValue(pattern.Value), value)
+	case *ast.ArrayPattern:
+		arr, ok := value.(*Array)
+		if !ok {
+			return false
+		}
+		n := len(pattern.Elements)
+		if len(arr.Elements) < n || pattern.Rest == nil && len(arr.Elements) != n {
+			return false
+		}
+		for i, el := range pattern.Elements {
+			if !match(el, arr.Elements[i], bound) {
+				return false
+			}
+		}
+		if pattern.Rest != nil {
+			remaining := make([]Object, len(arr.Elements)-n)
+			copy(remaining, arr.Elements[n:])
+			*bound = append(*bound, &Array{Elements: remaining})
+		}
+		return true
+	case *ast.HashPattern:
+		hash, ok := value.(*Hash)
+		if !ok {
+			return false
+		}
+		named := make(map[string]bool, len(pattern.Pairs))
+		for _, pair := range pattern.Pairs {
+			v, ok := hash.Get(&String{Value: pair.Key})
+			if !ok || !match(pair.Value, v, bound) {
+				return false
+			}
+			named[pair.Key] = true
+		}
+		if pattern.Rest != nil {
+			*bound = append(*bound, unnamedPairs(hash, named))
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func literalValue(lit ast.Expression) Object {
+	switch lit := lit.(type) {
+	case *ast.IntegerLiteral:
+		return &Integer{Value: lit.Value}
+	case *ast.PrefixExpression:
+		// The parser only builds these for negative integers
+		return &Integer{Value: -lit.Right.(*ast.IntegerLiteral).Value}
+	case *ast.StringLiteral:
+		return &String{Value: lit.Value}
+	case *ast.Boolean:
+		return NativeBool(lit.Value)
+	default:
+		return &Null{}
+	}
+}
@@ -0,0 +1,165 @@
+package object
+
+import "fmt"
+
+// Approximate sizes in bytes of arrays, strings and hashes on a 64-bit
+// machine: the struct with the pointer to it, and what every element,
+// byte or pair adds.
+const (
+	arraySize   = 32
+	elementSize = 16
+	stringSize  = 24
+	hashSize    = 96 // with its bucket map
+	pairSize    = 64 // with its bucket entry
+)
+
+// Size is about how many bytes obj takes, without the values it holds,
+// for the values a program can make as large as it likes: arrays, strings
+// and hashes. Others have a small fixed size and count as nothing.
+func Size(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *Array:
+		return arraySize + elementSize*int64(len(obj.Elements))
+	case *String:
+		return stringSize + int64(len(obj.Value))
+	case *Hash:
+		return hashSize + pairSize*int64(obj.Len())
+	default:
+		return 0
+	}
+}
+
+// Memory counts the arrays, strings and hashes a run builds, and stops it
+// once they take more than its limit. The garbage collector doesn't say
+// when a value is freed, so Memory keeps what is in use as what it last
+// measured plus everything built since. It measures again, with the
+// engine's measure func, once that has doubled and before stopping the
+// run, which makes values the run can no longer reach stop counting.
+type Memory struct {
+	limit   int64 // in bytes, 0 for no limit
+	measure func() int64
+	inUse   int64 // in bytes, as far as Memory knows
+	next    int64 // inUse to measure again at
+	stats   MemoryStats
+}
+
+// MemoryStats is what a run allocated.
+type MemoryStats struct {
+	Allocations    int64 // arrays, strings and hashes built
+	AllocatedBytes int64 // the bytes they took together
+	PeakBytes      int64 // the most bytes in use at once, as far as Memory knew
+}
+
+// minMeasure is how many bytes are in use before Memory first measures,
+// so that small runs don't measure at all.
+const minMeasure = 64 << 10
+
+// NewMemory makes the Memory of a run, where measure returns the bytes the
+// values the run can still reach take, see InUse. Without it nothing is
+// counted as no longer in use.
+func NewMemory(limit int64, measure func() int64) Memory {
+	return Memory{limit: limit, measure: measure, next: minMeasure}
+}
+
+// Allocate counts obj, a value that was just built, returning the error to
+// stop the run with when it goes over the limit.
+func (m *Memory) Allocate(obj Object) *LimitError {
+	size := Size(obj)
+	if size == 0 {
+		return nil
+	}
+
+	m.stats.Allocations++
+	m.stats.AllocatedBytes += size
+	m.inUse += size
+	if m.measure != nil && (m.inUse > m.next || m.limit > 0 && m.inUse > m.limit) {
+		// obj can't be reached yet, it's only about to be used
+		m.inUse = m.measure() + size
+		m.next = 2 * m.inUse
+		if m.next < minMeasure {
+			m.next = minMeasure
+		}
+	}
+	if m.inUse > m.stats.PeakBytes {
+		m.stats.PeakBytes = m.inUse
+	}
+	if m.limit > 0 && m.inUse > m.limit {
+		return &LimitError{Message: fmt.Sprintf("memory limit of %d bytes exceeded", m.limit)}
+	}
+	return nil
+}
+
+func (m *Memory) Stats() MemoryStats {
+	return m.stats
+}
+
+// InUse is how many bytes the arrays, strings and hashes that can be
+// reached from envs and roots take, counting each once. Values are
+// reached through what they hold, and functions through their
+// environments.
+func InUse(envs []*Environment, roots ...[]Object) int64 {
+	r := reach{seen: map[Object]bool{}, envs: map[*Environment]bool{}}
+	for _, env := range envs {
+		r.env(env)
+	}
+	for _, objs := range roots {
+		for _, obj := range objs {
+			r.object(obj)
+		}
+	}
+	return r.bytes
+}
+
+type reach struct {
+	seen  map[Object]bool
+	envs  map[*Environment]bool
+	bytes int64
+}
+
+func (r *reach) object(obj Object) {
+	if obj == nil || r.seen[obj] {
+		return
+	}
+	switch obj := obj.(type) {
+	case *Array:
+		r.seen[obj] = true
+		r.bytes += Size(obj)
+		for _, el := range obj.Elements {
+			r.object(el)
+		}
+	case *String:
+		r.seen[obj] = true
+		r.bytes += Size(obj)
+	case *Hash:
+		r.seen[obj] = true
+		r.bytes += Size(obj)
+		for _, pair := range obj.Pairs() {
+			r.object(pair.Key)
+			r.object(pair.Value)
+		}
+	case *Closure:
+		r.seen[obj] = true
+		for _, free := range obj.Free {
+			r.object(free)
+		}
+	case *Function:
+		r.seen[obj] = true
+		r.env(obj.Env)
+	case *Macro:
+		r.seen[obj] = true
+		r.env(obj.Env)
+	case *ReturnValue:
+		r.object(obj.Value)
+	case *Error:
+		r.object(obj.Value)
+	}
+}
+
+func (r *reach) env(env *Environment) {
+	for ; env != nil && !r.envs[env]; env = env.outer {
+		r.envs[env] = true
+		for _, obj := range env.store {
+			r.object(obj)
+		}
+	}
+}
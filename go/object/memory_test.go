@@ -0,0 +1,66 @@
+package object
+
+import "testing"
+
+func Test_MemoryAllocate(t *testing.T) {
+	m := NewMemory(100, nil)
+
+	if err := m.Allocate(&Integer{Value: 1}); err != nil {
+		t.Fatalf("integer counted against the limit: %s", err)
+	}
+	if err := m.Allocate(&String{Value: "hello"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := m.Allocate(&Array{Elements: []Object{&Integer{}, &Integer{}, &Integer{}, &Integer{}}}); err == nil {
+		t.Errorf("expected the limit to be exceeded")
+	}
+
+	expected := MemoryStats{Allocations: 2, AllocatedBytes: stringSize + 5 + arraySize + 4*elementSize, PeakBytes: stringSize + 5 + arraySize + 4*elementSize}
+	if stats := m.Stats(); stats != expected {
+		t.Errorf("wrong stats. want=%+v, got=%+v", expected, stats)
+	}
+}
+
+func Test_MemoryMeasure(t *testing.T) {
+	var inUse int64
+	m := NewMemory(1000, func() int64 { return inUse })
+
+	for i := 0; i < 100; i++ {
+		if err := m.Allocate(&String{Value: "0123456789"}); err != nil {
+			t.Fatalf("allocation %d: the strings no longer in use were counted: %s", i, err)
+		}
+	}
+
+	// Found once what was built since the last measure takes it past the
+	// limit
+	inUse = 990
+	var err *LimitError
+	for i := 0; err == nil && i < 100; i++ {
+		err = m.Allocate(&String{Value: "0123456789"})
+	}
+	if err == nil {
+		t.Fatalf("expected the limit to be exceeded")
+	}
+
+	if stats := m.Stats(); stats.PeakBytes != 990+stringSize+10 {
+		t.Errorf("wrong peak. want=%d, got=%d", 990+stringSize+10, stats.PeakBytes)
+	}
+}
+
+func Test_InUse(t *testing.T) {
+	shared := &String{Value: "abc"}
+	inner := &Array{Elements: []Object{shared, shared}}
+	hash := NewHash()
+	hash.Set(&String{Value: "k"}, inner)
+
+	env := CreateEnvironment()
+	env.Set("h", hash)
+	fnEnv := EncaseEnvironment(env)
+	fnEnv.Set("s", &String{Value: "de"})
+	env.Set("f", &Function{Env: fnEnv})
+
+	expected := Size(shared) + Size(inner) + Size(hash) + Size(&String{Value: "k"}) + Size(&String{Value: "de"})
+	if got := InUse([]*Environment{env, env}, []Object{inner, &Integer{Value: 1}, nil}); got != expected {
+		t.Errorf("wrong bytes in use. want=%d, got=%d", expected, got)
+	}
+}
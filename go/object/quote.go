@@ -0,0 +1,13 @@
+package object
+
+import "alde.nu/mint/ast"
+
+// Quote wraps an unevaluated AST node, as produced by `quote(...)`.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
@@ -1,6 +1,9 @@
 package object
 
-import "hash/fnv"
+import (
+	"hash/fnv"
+	"strings"
+)
 
 type String struct {
 	Value string
@@ -13,3 +16,17 @@ func (s *String) HashKey() HashKey {
 	h.Write([]byte(s.Value))
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
+
+// Interpolate joins the text parts of an interpolated string with the
+// values in between, as printed by Inspect. There is one more text part
+// than there are values.
+func Interpolate(parts []string, values []Object) *String {
+	var out strings.Builder
+	for i, part := range parts {
+		out.WriteString(part)
+		if i < len(values) {
+			out.WriteString(values[i].Inspect())
+		}
+	}
+	return &String{Value: out.String()}
+}
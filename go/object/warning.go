@@ -0,0 +1,67 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+
+	"alde.nu/mint/token"
+)
+
+// Warning points at a source location whose behaviour is likely to
+// surprise, without stopping the run.
+type Warning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Pos, w.Message)
+}
+
+// CaseFoldWarnings collects a Warning for every string comparison whose
+// result changed when `==` and `!=` stopped ignoring case, one per source
+// location. Both engines feed it their comparisons.
+type CaseFoldWarnings struct {
+	warned   map[token.Position]bool
+	warnings []Warning
+}
+
+// Check records a warning when comparing left and right with operator, at
+// pos, gives a different answer than before string equality became
+// case-sensitive.
+func (c *CaseFoldWarnings) Check(pos token.Position, operator string, left, right Object) {
+	if operator != "==" && operator != "!=" {
+		return
+	}
+	leftStr, ok := left.(*String)
+	if !ok {
+		return
+	}
+	rightStr, ok := right.(*String)
+	if !ok {
+		return
+	}
+	if leftStr.Value == rightStr.Value || !strings.EqualFold(leftStr.Value, rightStr.Value) {
+		return
+	}
+
+	if c.warned[pos] {
+		return
+	}
+	if c.warned == nil {
+		c.warned = make(map[token.Position]bool)
+	}
+	c.warned[pos] = true
+
+	msg := fmt.Sprintf("%q %s %q is %t, but was %t when string equality ignored case; use equal_fold() to keep the old behaviour",
+		leftStr.Value, operator, rightStr.Value, operator == "!=", operator == "==")
+	c.warnings = append(c.warnings, Warning{Pos: pos, Message: msg})
+}
+
+// Warnings returns the warnings recorded so far.
+func (c *CaseFoldWarnings) Warnings() []Warning {
+	if c == nil {
+		return nil
+	}
+	return c.warnings
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"alde.nu/mint/ast"
 	"alde.nu/mint/lexer"
@@ -12,38 +13,63 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	COALESCE
+	LOGICALOR
+	LOGICALAND
 	EQUALS
 	LESSGREATER
+	BITOR
+	BITXOR
+	BITAND
+	SHIFT
 	SUM
 	PRODUCT
 	PREFIX
+	POWER
 	CALL
 	INDEX
 )
 
 var precedence = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.NULLISH:   COALESCE,
+	token.OR:        LOGICALOR,
+	token.AND:       LOGICALAND,
+	token.EQ:        EQUALS,
+	token.NOT_EQ:    EQUALS,
+	token.LT:        LESSGREATER,
+	token.GT:        LESSGREATER,
+	token.LT_EQ:     LESSGREATER,
+	token.GT_EQ:     LESSGREATER,
+	token.PIPE:      BITOR,
+	token.CARET:     BITXOR,
+	token.AMPERSAND: BITAND,
+	token.LSHIFT:    SHIFT,
+	token.RSHIFT:    SHIFT,
+	token.PLUS:      SUM,
+	token.MINUS:     SUM,
+	token.SLASH:     PRODUCT,
+	token.ASTERISK:  PRODUCT,
+	token.PERCENT:   PRODUCT,
+	token.POWER:     POWER,
+	token.LPAREN:    CALL,
+	token.LBRACKET:  INDEX,
+	token.OPTIONAL:  INDEX,
 }
 
 type Parser struct {
 	l *lexer.Lexer
 
-	errors []string
+	errors   []string
+	warnings []string
 
 	currentToken token.Token
 	peekToken    token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	tracer     func(TraceEvent)
+	traceDepth int
 }
 
 type (
@@ -51,8 +77,11 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
-func Create(l *lexer.Lexer) *Parser {
+func Create(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{l: l, errors: []string{}}
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	// Prefix Parser functions
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
@@ -60,14 +89,20 @@ func Create(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 
 	// Infix Parser functions
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -79,8 +114,21 @@ func Create(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL, p.parseOptionalExpression)
 
 	// Read two tokens so currentToken and nextToken are both set
 	p.nextToken()
@@ -93,6 +141,16 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Warnings returns problems that don't stop the program from running,
+// each prefixed with the position it was found at.
+func (p *Parser) Warnings() []string {
+	return p.warnings
+}
+
+func (p *Parser) warn(pos token.Position, format string, a ...interface{}) {
+	p.warnings = append(p.warnings, pos.String()+": "+fmt.Sprintf(format, a...))
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
@@ -103,6 +161,15 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
+// peekTokenAt returns the token n places after the current one, so
+// peekTokenAt(1) is the peek token, without moving the parser forward.
+func (p *Parser) peekTokenAt(n int) token.Token {
+	if n <= 1 {
+		return p.peekToken
+	}
+	return p.l.PeekToken(n - 2)
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	prog := &ast.Program{}
 	prog.Statements = []ast.Statement{}
@@ -114,23 +181,28 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	for _, comment := range p.l.Comments() {
+		prog.Comments = append(prog.Comments, &ast.Comment{Token: comment})
+	}
 	return prog
 }
 
 func (p *Parser) parseStatement() ast.Statement {
-	defer untrace(trace("parseStatement"))
+	defer p.untrace(p.trace("parseStatement"))
 	switch p.currentToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
-	defer untrace(trace("parseGroupedExpression"))
+	defer p.untrace(p.trace("parseGroupedExpression"))
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
@@ -140,12 +212,20 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	defer untrace(trace("parseLetStatement"))
+	defer p.untrace(p.trace("parseLetStatement"))
 	stmt := &ast.LetStatement{Token: p.currentToken}
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Pattern = p.parsePattern(false)
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	}
-	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -154,6 +234,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+		fl.Name = stmt.Name.Value
+	}
+
 	for p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -161,8 +245,150 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// parsePattern parses the target of a destructuring let or the pattern of
+// a match arm. Only refutable patterns, the ones in match arms, can hold
+// literals that a value may fail to match.
+func (p *Parser) parsePattern(refutable bool) ast.Pattern {
+	defer p.untrace(p.trace("parsePattern"))
+	switch p.currentToken.Type {
+	case token.IDENT:
+		if p.currentToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.currentToken}
+		}
+		return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern(refutable)
+	case token.LBRACE:
+		return p.parseHashPattern(refutable)
+	case token.INT, token.MINUS, token.STRING, token.TRUE, token.FALSE, token.NULL:
+		if !refutable {
+			msg := fmt.Sprintf("literal patterns are only allowed in match arms, got %s", p.currentToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		return p.parseLiteralPattern()
+	default:
+		msg := fmt.Sprintf("expected pattern, got %s instead", p.currentToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
+
+func (p *Parser) parseLiteralPattern() ast.Pattern {
+	pattern := &ast.LiteralPattern{Token: p.currentToken}
+	switch p.currentToken.Type {
+	case token.MINUS:
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		integer := p.parseIntegerLiteral()
+		if integer == nil {
+			return nil
+		}
+		pattern.Value = &ast.PrefixExpression{Token: pattern.Token, Operator: "-", Right: integer}
+	case token.INT:
+		pattern.Value = p.parseIntegerLiteral()
+	case token.STRING:
+		pattern.Value = p.parseStringLiteral()
+	case token.NULL:
+		pattern.Value = p.parseNull()
+	default:
+		pattern.Value = p.parseBoolean()
+	}
+	if pattern.Value == nil {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseArrayPattern(refutable bool) ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currentToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.currentTokenIs(token.ELLIPSIS) {
+			pattern.Rest = p.parseRestIdentifier()
+			if pattern.Rest == nil {
+				return nil
+			}
+			// ...rest has to come last
+			break
+		}
+
+		element := p.parsePattern(refutable)
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseHashPattern(refutable bool) ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currentToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		if p.currentTokenIs(token.ELLIPSIS) {
+			pattern.Rest = p.parseRestIdentifier()
+			if pattern.Rest == nil {
+				return nil
+			}
+			// ...rest has to come last
+			break
+		}
+
+		if !p.currentTokenIs(token.IDENT) && !p.currentTokenIs(token.STRING) {
+			msg := fmt.Sprintf("expected hash pattern key, got %s instead", p.currentToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+
+		pair := ast.HashPatternPair{Key: p.currentToken.Literal}
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			pair.Value = p.parsePattern(refutable)
+			if pair.Value == nil {
+				return nil
+			}
+		} else if p.currentTokenIs(token.IDENT) {
+			// The shorthand {name} binds the key to a variable of the same name
+			pair.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		} else {
+			p.peekError(token.COLON)
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, pair)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseRestIdentifier() *ast.Identifier {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	defer untrace(trace("parseReturnStatement"))
+	defer p.untrace(p.trace("parseReturnStatement"))
 	stmt := &ast.ReturnStatement{Token: p.currentToken}
 	p.nextToken()
 
@@ -174,8 +400,21 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	defer p.untrace(p.trace("parseThrowStatement"))
+	stmt := &ast.ThrowStatement{Token: p.currentToken}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	defer untrace(trace("parseExpressionStatement"))
+	defer p.untrace(p.trace("parseExpressionStatement"))
 	stmt := &ast.ExpressionStatement{Token: p.currentToken}
 	stmt.Expression = p.parseExpression(LOWEST)
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -185,7 +424,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	defer untrace(trace("parseInfixExpression"))
+	defer p.untrace(p.trace("parseInfixExpression"))
 	expression := &ast.InfixExpression{
 		Token:    p.currentToken,
 		Operator: p.currentToken.Literal,
@@ -193,6 +432,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.currentPrecedence()
+	// Exponentiation is right-associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+	if p.currentTokenIs(token.POWER) {
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
@@ -200,17 +443,15 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	defer untrace(trace("parseCallExpression"))
-	return &ast.CallExpression{
-		Token:     p.currentToken,
-		Function:  function,
-		Arguments: p.parseCallArguments(),
-	}
+	defer p.untrace(p.trace("parseCallExpression"))
+	call := &ast.CallExpression{Token: p.currentToken, Function: function}
+	call.Arguments = p.parseCallArguments()
+	call.Rparen = p.currentToken.Pos
+	return call
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currentToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -222,7 +463,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
-		hash.Pairs[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashLiteralPair{Key: key, Value: value})
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -232,14 +473,15 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.currentToken.Pos
 	return hash
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	return &ast.ArrayLiteral{
-		Token:    p.currentToken,
-		Elements: p.parseExpressionList(token.RBRACKET),
-	}
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.currentToken.Pos
+	return array
 }
 
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
@@ -265,20 +507,68 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseIndexExpression parses a[i] as well as the slice forms a[low:high],
+// a[:high], a[low:] and a[:].
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currentToken, Left: left}
+	tok := p.currentToken
+
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if !p.peekTokenIs(token.COLON) {
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+	}
 
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	slice := &ast.SliceExpression{Token: tok, Left: left, Low: index}
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		slice.High = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
-	return exp
+	return slice
+}
+
+// parseOptionalExpression parses the safe navigation forms a?.[i] and
+// f?.(args), which are index and call expressions marked as optional.
+func (p *Parser) parseOptionalExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseOptionalExpression"))
+	switch {
+	case p.peekTokenIs(token.LBRACKET):
+		p.nextToken()
+		switch exp := p.parseIndexExpression(left).(type) {
+		case *ast.IndexExpression:
+			exp.Optional = true
+			return exp
+		case *ast.SliceExpression:
+			exp.Optional = true
+			return exp
+		default:
+			return nil
+		}
+	case p.peekTokenIs(token.LPAREN):
+		p.nextToken()
+		exp := p.parseCallExpression(left).(*ast.CallExpression)
+		exp.Optional = true
+		return exp
+	default:
+		msg := fmt.Sprintf("expected [ or ( after ?., got %s instead", p.peekToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
 }
 
 func (p *Parser) parseCallArguments() []ast.Expression {
-	defer untrace(trace("parseCallArguments"))
+	defer p.untrace(p.trace("parseCallArguments"))
 	args := []ast.Expression{}
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
@@ -306,7 +596,7 @@ func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	defer untrace(trace("parseExpression"))
+	defer p.untrace(p.trace("parseExpression"))
 	prefix := p.prefixParseFns[p.currentToken.Type]
 
 	if prefix == nil {
@@ -330,13 +620,17 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	defer untrace(trace("parseIdentifier"))
+	defer p.untrace(p.trace("parseIdentifier"))
 	return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	defer untrace(trace("parseIntegerLiteral"))
+	defer p.untrace(p.trace("parseIntegerLiteral"))
 	lit := &ast.IntegerLiteral{Token: p.currentToken}
+	if msg := checkIntegerLiteral(p.currentToken.Literal); msg != "" {
+		p.errors = append(p.errors, msg)
+		return nil
+	}
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
@@ -348,8 +642,64 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// checkIntegerLiteral explains what is wrong with a malformed integer
+// literal, or returns "" for a well-formed one. Literals are decimal
+// unless they start with 0x, 0o or 0b, or with just 0 for old style
+// octal, and can have single underscores between digits.
+func checkIntegerLiteral(literal string) string {
+	base, name, digits := 10, "decimal", literal
+	if len(literal) > 1 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			base, name, digits = 16, "hexadecimal", literal[2:]
+		case 'o', 'O':
+			base, name, digits = 8, "octal", literal[2:]
+		case 'b', 'B':
+			base, name, digits = 2, "binary", literal[2:]
+		default:
+			base, name = 8, "octal"
+		}
+	}
+
+	for _, ch := range digits {
+		if ch != '_' && digitValue(ch) >= base {
+			return fmt.Sprintf("invalid digit %q in %s literal %s", ch, name, literal)
+		}
+	}
+	if strings.Trim(digits, "_") == "" {
+		return fmt.Sprintf("%s literal %s has no digits", name, literal)
+	}
+
+	// An underscore can follow the base prefix, otherwise it has to be
+	// between two digits
+	prefix := len(literal) - len(digits)
+	for i := prefix; i < len(literal); i++ {
+		if literal[i] != '_' {
+			continue
+		}
+		before := i == prefix && prefix > 0 || i > prefix && literal[i-1] != '_'
+		after := i+1 < len(literal) && literal[i+1] != '_'
+		if !before || !after {
+			return fmt.Sprintf("'_' must separate successive digits in %s", literal)
+		}
+	}
+	return ""
+}
+
+func digitValue(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'z':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'Z':
+		return int(ch-'A') + 10
+	}
+	return 36
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	defer untrace(trace("parsePrefixExpression"))
+	defer p.untrace(p.trace("parsePrefixExpression"))
 	expression := &ast.PrefixExpression{
 		Token:    p.currentToken,
 		Operator: p.currentToken.Literal,
@@ -361,12 +711,103 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
-	defer untrace(trace("parseBoolean"))
+	defer p.untrace(p.trace("parseBoolean"))
 	return &ast.Boolean{Token: p.currentToken, Value: p.currentTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseMatchExpression() ast.Expression {
+	defer p.untrace(p.trace("parseMatchExpression"))
+	exp := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := &ast.MatchArm{Token: p.currentToken}
+		arm.Pattern = p.parsePattern(true)
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+		if p.currentTokenIs(token.LBRACE) && !p.hashLiteralAhead() {
+			arm.Body = p.parseBlockStatement()
+		} else {
+			arm.Body = p.parseExpression(LOWEST)
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	exp.Rbrace = p.currentToken.Pos
+
+	p.checkMatchArms(exp)
+	return exp
+}
+
+// hashLiteralAhead tells a hash literal from a block when the current
+// token is a {: it is a hash when it is empty or its first key is a
+// single token followed by a colon. A hash whose first key is longer has
+// to be put in parentheses where a block can go.
+func (p *Parser) hashLiteralAhead() bool {
+	return p.peekTokenIs(token.RBRACE) || p.peekTokenAt(2).Type == token.COLON
+}
+
+// checkMatchArms warns about arms that come after a catch-all and so can
+// never be reached, and about matches without a catch-all, which evaluate
+// to null for values none of their arms match.
+func (p *Parser) checkMatchArms(exp *ast.MatchExpression) {
+	exhaustive := false
+	for _, arm := range exp.Arms {
+		if exhaustive {
+			p.warn(arm.Token.Pos, "unreachable match arm %s", arm.Pattern)
+			continue
+		}
+		if arm.Guard != nil {
+			continue
+		}
+		switch arm.Pattern.(type) {
+		case *ast.WildcardPattern, *ast.Identifier:
+			exhaustive = true
+		}
+	}
+
+	if !exhaustive {
+		p.warn(exp.Token.Pos, "match is not exhaustive, add a _ arm to handle other values")
+	}
+}
+
+func (p *Parser) parseNull() ast.Expression {
+	defer p.untrace(p.trace("parseNull"))
+	return &ast.NullLiteral{Token: p.currentToken}
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
-	defer untrace(trace("parseIfExpression"))
+	defer p.untrace(p.trace("parseIfExpression"))
 	expression := &ast.IfExpression{Token: p.currentToken}
 
 	if !p.expectPeek(token.LPAREN) {
@@ -397,8 +838,46 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	defer p.untrace(p.trace("parseTryExpression"))
+	expression := &ast.TryExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Parameter = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		msg := fmt.Sprintf("expected catch or finally after try block, got %s instead", p.peekToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	defer untrace(trace("parseBlockStatement"))
+	defer p.untrace(p.trace("parseBlockStatement"))
 	block := &ast.BlockStatement{Token: p.currentToken}
 	block.Statements = []ast.Statement{}
 
@@ -411,12 +890,28 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.currentToken.Pos
 	return block
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
-	defer untrace(trace("parseFunctionLiteral"))
-	lit := &ast.FunctionLiteral{}
+	defer p.untrace(p.trace("parseFunctionLiteral"))
+	lit := &ast.FunctionLiteral{Token: p.currentToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseMacroLiteral"))
+	lit := &ast.MacroLiteral{Token: p.currentToken}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
@@ -430,7 +925,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 }
 
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	defer untrace(trace("parseFunctionParameters"))
+	defer p.untrace(p.trace("parseFunctionParameters"))
 	identifiers := []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
@@ -457,10 +952,44 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
-	defer untrace(trace("parseStringLiteral"))
+	defer p.untrace(p.trace("parseStringLiteral"))
 	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
+// parseInterpolatedString parses the parts of "a ${b} c ${d} e", which
+// the lexer splits into STRING_HEAD, b, STRING_MID, d and STRING_TAIL.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	defer p.untrace(p.trace("parseInterpolatedString"))
+	str := &ast.InterpolatedString{Token: p.currentToken}
+	str.Strings = append(str.Strings, p.currentToken.Literal)
+
+	for {
+		p.nextToken()
+		if p.currentTokenIs(token.STRING_MID) || p.currentTokenIs(token.STRING_TAIL) {
+			p.errors = append(p.errors, "empty ${} in string")
+			return nil
+		}
+		exp := p.parseExpression(LOWEST)
+		if exp == nil {
+			return nil
+		}
+		str.Expressions = append(str.Expressions, exp)
+
+		p.nextToken()
+		switch p.currentToken.Type {
+		case token.STRING_MID:
+			str.Strings = append(str.Strings, p.currentToken.Literal)
+		case token.STRING_TAIL:
+			str.Strings = append(str.Strings, p.currentToken.Literal)
+			return str
+		default:
+			msg := fmt.Sprintf("expected } to end the ${ in string, got %s instead", p.currentToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+}
+
 /// Helper functions /////////////////////////////////////////////////
 
 func (p *Parser) currentTokenIs(t token.TokenType) bool {
@@ -480,18 +1009,21 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedence[p.peekToken.Type]; ok {
+// Precedence returns how tightly the infix operator t binds, or LOWEST
+// when t isn't one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedence[t]; ok {
 		return p
 	}
 	return LOWEST
 }
 
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
+
 func (p *Parser) currentPrecedence() int {
-	if p, ok := precedence[p.currentToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.currentToken.Type)
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
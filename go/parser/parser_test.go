@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	"alde.nu/mint/ast"
@@ -38,6 +40,200 @@ func Test_LetStatements(t *testing.T) {
 	}
 }
 
+func Test_DestructuringLetStatements(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = xs;", "let [a, b] = xs;"},
+		{"let [a, ...rest] = xs;", "let [a, ...rest] = xs;"},
+		{"let [...all] = xs;", "let [...all] = xs;"},
+		{"let [] = xs;", "let [] = xs;"},
+		{"let [a, [b, c]] = xs;", "let [a, [b, c]] = xs;"},
+		{"let {name, age: years} = person;", "let {name, age: years} = person;"},
+		{`let {"first name": first, ...others} = person;`, `let {"first name": first, ...others} = person;`},
+		{"let {pos: [x, y]} = p;", "let {pos: [x, y]} = p;"},
+	}
+
+	for _, tt := range testData {
+		program := initTests(t, tt.input)
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("statement not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Pattern == nil {
+			t.Errorf("%s: let statement has no pattern", tt.input)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func Test_DestructuringLetErrors(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, ...rest, b] = xs;", "expected next token to be ], got , instead"},
+		{"let [1] = xs;", "literal patterns are only allowed in match arms, got INT"},
+		{"let [+] = xs;", "expected pattern, got + instead"},
+		{"let {1: a} = xs;", "expected hash pattern key, got INT instead"},
+		{`let {"a"} = xs;`, "expected next token to be :, got } instead"},
+		{"let [...] = xs;", "expected next token to be IDENT, got ] instead"},
+	}
+
+	for _, tt := range testData {
+		p := Create(lexer.Create(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%s: wrong parser errors. want %q first, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func Test_MatchExpression(t *testing.T) {
+	input := `match (x) {
+		0 => "zero",
+		-1 => "minus one",
+		[a, ...rest] if a > 0 => rest,
+		{"name": n, age} => n,
+		null => "null",
+		_ => "other",
+	}`
+	p := Create(lexer.Create(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	match, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, match.Subject, "x") {
+		return
+	}
+
+	expected := []string{
+		`0 => zero`,
+		`(-1) => minus one`,
+		`[a, ...rest] if (a > 0) => rest`,
+		`{name: n, age} => n`,
+		`null => null`,
+		`_ => other`,
+	}
+	if len(match.Arms) != len(expected) {
+		t.Fatalf("match has wrong number of arms. want=%d, got=%d", len(expected), len(match.Arms))
+	}
+	for i, arm := range match.Arms {
+		armString := arm.Pattern.String()
+		if arm.Guard != nil {
+			armString += " if " + arm.Guard.String()
+		}
+		armString += " => " + arm.Body.String()
+		if armString != expected[i] {
+			t.Errorf("arm %d wrong. want=%q, got=%q", i, expected[i], armString)
+		}
+	}
+	if len(p.Warnings()) != 0 {
+		t.Errorf("exhaustive match has warnings: %q", p.Warnings())
+	}
+}
+
+func Test_MatchArmBodies(t *testing.T) {
+	testData := []struct {
+		input      string
+		bodyType   string
+		statements int // in a block body
+	}{
+		{`match (x) { 1 => { let a = 2; a }, _ => 0 }`, "*ast.BlockStatement", 2},
+		{`match (x) { 1 => { a }, _ => 0 }`, "*ast.BlockStatement", 1},
+		{`match (x) { 1 => {
+			puts(x)
+			x
+		}, _ => 0 }`, "*ast.BlockStatement", 2},
+		{`match (x) { 1 => {"a": 1}, _ => 0 }`, "*ast.HashLiteral", 0},
+		{`match (x) { 1 => {a: 1}, _ => 0 }`, "*ast.HashLiteral", 0},
+		{`match (x) { 1 => {}, _ => 0 }`, "*ast.HashLiteral", 0},
+		{`match (x) { 1 => ({[1]: 2}), _ => 0 }`, "*ast.HashLiteral", 0},
+	}
+
+	for _, tt := range testData {
+		p := Create(lexer.Create(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		match := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+		body := match.Arms[0].Body
+		if got := fmt.Sprintf("%T", body); got != tt.bodyType {
+			t.Errorf("%s: body is %s, want %s", tt.input, got, tt.bodyType)
+			continue
+		}
+		if block, ok := body.(*ast.BlockStatement); ok && len(block.Statements) != tt.statements {
+			t.Errorf("%s: block has %d statements, want %d", tt.input, len(block.Statements), tt.statements)
+		}
+	}
+}
+
+func Test_MatchWarnings(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected []string
+	}{
+		{"match (x) { 1 => 2 }", []string{"1:1: match is not exhaustive, add a _ arm to handle other values"}},
+		{"match (x) { y if y > 1 => 2 }", []string{"1:1: match is not exhaustive, add a _ arm to handle other values"}},
+		{"match (x) { y => 2, 1 => 3, _ => 4 }", []string{
+			"1:21: unreachable match arm 1",
+			"1:29: unreachable match arm _",
+		}},
+		{"match (x) { y if y > 1 => 2, _ => 4 }", nil},
+	}
+
+	for _, tt := range testData {
+		p := Create(lexer.Create(tt.input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(p.Warnings()) != len(tt.expected) {
+			t.Errorf("%s: wrong warnings. want=%q, got=%q", tt.input, tt.expected, p.Warnings())
+			continue
+		}
+		for i, warning := range p.Warnings() {
+			if warning != tt.expected[i] {
+				t.Errorf("%s: wrong warning. want=%q, got=%q", tt.input, tt.expected[i], warning)
+			}
+		}
+	}
+}
+
+func Test_ProgramComments(t *testing.T) {
+	input := `// first
+let x = 1; // second
+fn(x) {
+	// third
+	x
+}`
+
+	l := lexer.Create(input)
+	l.KeepComments()
+	p := Create(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{"// first", "// second", "// third"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expected), len(program.Comments))
+	}
+	for i, comment := range program.Comments {
+		if comment.Token.Literal != expected[i] {
+			t.Errorf("comments[%d] wrong. expected=%q, got=%q", i, expected[i], comment.Token.Literal)
+		}
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("comments ended up as statements, got %d statements", len(program.Statements))
+	}
+}
+
 func Test_ReturnStatements(t *testing.T) {
 	testData := []struct {
 		input    string
@@ -140,6 +336,71 @@ func Test_IntegerExpression(t *testing.T) {
 	testLiteralExpression(t, stmt.Expression, 54)
 }
 
+func Test_IntegerLiteralBases(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0XfF", 255},
+		{"0o755", 493},
+		{"0O17", 15},
+		{"0b1010", 10},
+		{"0B1", 1},
+		{"1_000_000", 1000000},
+		{"0x_FF_FF", 65535},
+		{"0b_1010_1010", 170},
+		{"0", 0},
+	}
+
+	for _, tt := range testData {
+		program := initTests(t, tt.input)
+		integer := basicParsingChecks(t, program, 1, &ast.IntegerLiteral{})
+		if integer.Value != tt.expected {
+			t.Errorf("wrong value for %s. want=%d, got=%d", tt.input, tt.expected, integer.Value)
+		}
+		if integer.Token.Literal != tt.input {
+			t.Errorf("spelling not kept. want=%q, got=%q", tt.input, integer.Token.Literal)
+		}
+	}
+}
+
+func Test_MalformedIntegerLiterals(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"0x", "hexadecimal literal 0x has no digits"},
+		{"0b_", "binary literal 0b_ has no digits"},
+		{"0o", "octal literal 0o has no digits"},
+		{"1__0", "'_' must separate successive digits in 1__0"},
+		{"1_", "'_' must separate successive digits in 1_"},
+		{"0x_", "hexadecimal literal 0x_ has no digits"},
+		{"0xF_", "'_' must separate successive digits in 0xF_"},
+		{"0x__1", "'_' must separate successive digits in 0x__1"},
+		{"0b102", "invalid digit '2' in binary literal 0b102"},
+		{"0o8", "invalid digit '8' in octal literal 0o8"},
+		{"09", "invalid digit '9' in octal literal 09"},
+		{"12ab", "invalid digit 'a' in decimal literal 12ab"},
+		{"0xG", "invalid digit 'G' in hexadecimal literal 0xG"},
+		{"9223372036854775808", `could not parse "9223372036854775808" as integer`},
+	}
+
+	for _, tt := range testData {
+		p := Create(lexer.Create(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %s. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func Test_ParsingPrefixExpressions(t *testing.T) {
 	testData := []struct {
 		input    string
@@ -148,6 +409,7 @@ func Test_ParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15;", "-", 15},
+		{"~15;", "~", 15},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
 	}
@@ -184,6 +446,18 @@ func Test_ParsingInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"true && false", true, "&&", false},
+		{"a || b", "a", "||", "b"},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"a ?? b", "a", "??", "b"},
 	}
 
 	for _, tt := range testData {
@@ -239,6 +513,35 @@ func Test_OperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a == b && c < d", "((a == b) && (c < d))"},
+		{"!a && b", "((!a) && b)"},
+		{"a || b || c", "((a || b) || c)"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"-2 ** 2", "(-(2 ** 2))"},
+		{"2 ** -1", "(2 ** (-1))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a % b * c", "((a % b) * c)"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d))"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)))"},
+		{"a & b == c", "((a & b) == c)"},
+		{"1 << 2 + 3", "(1 << (2 + 3))"},
+		{"a >> b < c", "((a >> b) < c)"},
+		{"~a & b", "((~a) & b)"},
+		{"null", "null"},
+		{"a ?? b || c", "(a ?? (b || c))"},
+		{"a || b ?? c", "((a || b) ?? c)"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{`a?.["b"]?.["c"] ?? d`, "(((a?.[b])?.[c]) ?? d)"},
+		{"f?.(a, b)[0]", "(f?.(a, b)[0])"},
+		{"-a?.[0]", "(-(a?.[0]))"},
+		{"a[1:2]", "(a[1:2])"},
+		{"a[:b + 1]", "(a[:(b + 1)])"},
+		{"a[-1:]", "(a[(-1):])"},
+		{"a[:]", "(a[:])"},
+		{"a?.[1:]", "(a?.[1:])"},
+		{"a[1:][0]", "((a[1:])[0])"},
 	}
 
 	for _, tt := range testData {
@@ -318,6 +621,85 @@ func Test_IfElseExpression(t *testing.T) {
 	}
 }
 
+func Test_TryExpression(t *testing.T) {
+	testData := []struct {
+		input     string
+		parameter string
+		catch     string
+		finally   string
+	}{
+		{"try { x } catch (e) { y }", "e", "y", ""},
+		{"try { x } finally { z }", "", "", "z"},
+		{"try { x } catch (err) { y } finally { z }", "err", "y", "z"},
+	}
+
+	for _, tt := range testData {
+		program := initTests(t, tt.input)
+		exp := basicParsingChecks(t, program, 1, &ast.TryExpression{})
+
+		if exp.Block.String() != "x" {
+			t.Errorf("wrong try block. got=%q", exp.Block.String())
+		}
+		if tt.catch == "" {
+			if exp.Catch != nil {
+				t.Errorf("unexpected catch block %q", exp.Catch.String())
+			}
+		} else {
+			testIdentifier(t, exp.Parameter, tt.parameter)
+			if exp.Catch == nil || exp.Catch.String() != tt.catch {
+				t.Errorf("wrong catch block. want=%q, got=%+v", tt.catch, exp.Catch)
+			}
+		}
+		if tt.finally == "" {
+			if exp.Finally != nil {
+				t.Errorf("unexpected finally block %q", exp.Finally.String())
+			}
+		} else if exp.Finally == nil || exp.Finally.String() != tt.finally {
+			t.Errorf("wrong finally block. want=%q, got=%+v", tt.finally, exp.Finally)
+		}
+	}
+}
+
+func Test_ThrowStatement(t *testing.T) {
+	program := initTests(t, `throw "boom";`)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	if stmt.String() != `throw boom;` {
+		t.Errorf("wrong statement. got=%q", stmt.String())
+	}
+}
+
+func Test_MalformedTryExpressions(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{"try { x }", "expected catch or finally after try block, got EOF instead"},
+		{"try { x } catch { y }", "expected next token to be (, got { instead"},
+		{"try { x } catch (1) { y }", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range testData {
+		p := Create(lexer.Create(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %s. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func Test_FunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y}`
 
@@ -342,6 +724,30 @@ func Test_FunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, body.Expression, "x", "+", "y")
 }
 
+func Test_MacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	program := initTests(t, input)
+	macro := basicParsingChecks(t, program, 1, &ast.MacroLiteral{})
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. Want 2, got %d\n", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements count is wrong. Expected %d, got %d\n", 1, len(macro.Body.Statements))
+	}
+
+	body, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro.Body.Statement[0] is not an ast.ExpressionStatement, got=%T\n", macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, body.Expression, "x", "+", "y")
+}
+
 func Test_ParameterParsin(t *testing.T) {
 	testData := []struct {
 		input    string
@@ -377,6 +783,9 @@ func Test_CallExpression(t *testing.T) {
 	if !testIdentifier(t, exp.Function, "add") {
 		return
 	}
+	if exp.Token.Literal != "(" || exp.Token.Pos.Column != 4 {
+		t.Errorf("call token wrong, want ( at 1:4, got %q at %s", exp.Token.Literal, exp.Token.Pos)
+	}
 
 	if len(exp.Arguments) != 3 {
 		t.Fatalf("expected 3 arguments, got %d (%s)", len(exp.Arguments), exp.Arguments)
@@ -428,6 +837,59 @@ func Test_StringLiteralExpression(t *testing.T) {
 	}
 }
 
+func Test_InterpolatedStringExpression(t *testing.T) {
+	input := `"Hello ${name}, you have ${len(items) + 1} items"`
+	program := initTests(t, input)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString, got %T", stmt.Expression)
+	}
+
+	expectedStrings := []string{"Hello ", ", you have ", " items"}
+	if len(str.Strings) != len(expectedStrings) {
+		t.Fatalf("wrong number of strings. want=%d, got=%d", len(expectedStrings), len(str.Strings))
+	}
+	for i, s := range expectedStrings {
+		if str.Strings[i] != s {
+			t.Errorf("str.Strings[%d] not %q. got %q", i, s, str.Strings[i])
+		}
+	}
+
+	if len(str.Expressions) != 2 {
+		t.Fatalf("wrong number of expressions. want=2, got=%d", len(str.Expressions))
+	}
+	testIdentifier(t, str.Expressions[0], "name")
+	if str.Expressions[1].String() != "(len(items) + 1)" {
+		t.Errorf("wrong second expression. got %s", str.Expressions[1].String())
+	}
+}
+
+func Test_MalformedInterpolatedStrings(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${} b"`, "empty ${} in string"},
+		{`"a ${x y} b"`, "expected } to end the ${ in string, got IDENT instead"},
+	}
+
+	for _, tt := range testData {
+		p := Create(lexer.Create(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %s. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func Test_ParseArrayLiteral(t *testing.T) {
 	input := `[1, 2*2, "foo", 3+3]`
 
@@ -467,6 +929,71 @@ func Test_ParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func Test_ParsingOptionalExpressions(t *testing.T) {
+	program := initTests(t, `a?.[1]; f?.(1)`)
+
+	index, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", program.Statements[0])
+	}
+	if !index.Optional {
+		t.Errorf("index expression is not optional")
+	}
+
+	call, ok := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.CallExpression. got=%T", program.Statements[1])
+	}
+	if !call.Optional {
+		t.Errorf("call expression is not optional")
+	}
+
+	p := Create(lexer.Create("a?.b"))
+	p.ParseProgram()
+	expected := "expected [ or ( after ?., got IDENT instead"
+	if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+		t.Errorf("wrong parser errors. want %q first, got=%q", expected, p.Errors())
+	}
+}
+
+func Test_ParsingSliceExpressions(t *testing.T) {
+	testData := []struct {
+		input string
+		low   interface{}
+		high  interface{}
+	}{
+		{"a[1:2]", 1, 2},
+		{"a[:2]", nil, 2},
+		{"a[1:]", 1, nil},
+		{"a[:]", nil, nil},
+	}
+
+	for _, tt := range testData {
+		program := initTests(t, tt.input)
+		stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, slice.Left, "a") {
+			return
+		}
+		for _, bound := range []struct {
+			exp      ast.Expression
+			expected interface{}
+		}{{slice.Low, tt.low}, {slice.High, tt.high}} {
+			if bound.expected == nil {
+				if bound.exp != nil {
+					t.Errorf("%s: bound should be omitted, got %s", tt.input, bound.exp)
+				}
+				continue
+			}
+			testLiteralExpression(t, bound.exp, bound.expected)
+		}
+	}
+}
+
 func Test_ParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	program := initTests(t, input)
@@ -482,21 +1009,26 @@ func Test_ParsingHashLiteralsStringKeys(t *testing.T) {
 		t.Fatalf("hash.Paris has wrong length, got=%d", len(hash.Pairs))
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+		if literal.String() != expected[i].key {
+			t.Errorf("pair %d has wrong key, want %q, got %q", i, expected[i].key, literal.String())
 		}
 
-		expectedValue := expected[literal.String()]
-
-		testIntegerLiteral(t, value, expectedValue)
+		testIntegerLiteral(t, pair.Value, expected[i].value)
 	}
 }
 
@@ -537,10 +1069,10 @@ func Test_ParseHashLiteralWithExpressions(t *testing.T) {
 		"three": func(e ast.Expression) { testInfixExpression(t, e, 15, "/", 5) },
 	}
 
-	for key, value := range hash.Pairs {
-		lit, ok := key.(*ast.StringLiteral)
+	for _, pair := range hash.Pairs {
+		lit, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
 			continue
 		}
 		testFunc, ok := testData[lit.String()]
@@ -549,7 +1081,106 @@ func Test_ParseHashLiteralWithExpressions(t *testing.T) {
 			continue
 		}
 
-		testFunc(value)
+		testFunc(pair.Value)
+	}
+}
+
+func Test_Tracing(t *testing.T) {
+	events := []TraceEvent{}
+	p := Create(lexer.Create("-x"), WithTraceFunc(func(e TraceEvent) {
+		events = append(events, e)
+	}))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []struct {
+		kind   TraceKind
+		rule   string
+		depth  int
+		column int
+	}{
+		{TraceEnter, "parseStatement", 1, 1},
+		{TraceEnter, "parseExpressionStatement", 2, 1},
+		{TraceEnter, "parseExpression", 3, 1},
+		{TraceEnter, "parsePrefixExpression", 4, 1},
+		{TraceEnter, "parseExpression", 5, 2},
+		{TraceEnter, "parseIdentifier", 6, 2},
+		{TraceExit, "parseIdentifier", 6, 2},
+		{TraceExit, "parseExpression", 5, 2},
+		{TraceExit, "parsePrefixExpression", 4, 2},
+		{TraceExit, "parseExpression", 3, 2},
+		{TraceExit, "parseExpressionStatement", 2, 2},
+		{TraceExit, "parseStatement", 1, 2},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("wrong number of events. want=%d, got=%d (%v)", len(expected), len(events), events)
+	}
+	for i, tt := range expected {
+		e := events[i]
+		if e.Kind != tt.kind || e.Rule != tt.rule || e.Depth != tt.depth || e.Token.Pos.Column != tt.column {
+			t.Errorf("events[%d] wrong. want=%v %s depth %d at column %d, got=%v %s depth %d at %s",
+				i, tt.kind, tt.rule, tt.depth, tt.column, e.Kind, e.Rule, e.Depth, e.Token.Pos)
+		}
+	}
+}
+
+func Test_TraceWriter(t *testing.T) {
+	var out strings.Builder
+	p := Create(lexer.Create("x"), WithTrace(&out))
+	p.ParseProgram()
+
+	expected := `BEGIN parseStatement (1:1 IDENT "x")
+	BEGIN parseExpressionStatement (1:1 IDENT "x")
+		BEGIN parseExpression (1:1 IDENT "x")
+			BEGIN parseIdentifier (1:1 IDENT "x")
+			END parseIdentifier (1:1 IDENT "x")
+		END parseExpression (1:1 IDENT "x")
+	END parseExpressionStatement (1:1 IDENT "x")
+END parseStatement (1:1 IDENT "x")
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func Test_ConcurrentTracing(t *testing.T) {
+	input := `let f = fn(a, b) { match (a) { [x, ...r] if x > b => r, _ => [] } }; f([1, 2], 0)`
+
+	var want strings.Builder
+	Create(lexer.Create(input), WithTrace(&want)).ParseProgram()
+
+	var wg sync.WaitGroup
+	traces := make([]strings.Builder, 8)
+	for i := range traces {
+		wg.Add(1)
+		go func(out *strings.Builder) {
+			defer wg.Done()
+			Create(lexer.Create(input), WithTrace(out)).ParseProgram()
+		}(&traces[i])
+	}
+	wg.Wait()
+
+	for i := range traces {
+		if traces[i].String() != want.String() {
+			t.Errorf("trace %d differs from the sequential one", i)
+		}
+	}
+}
+
+func Test_PeekTokenAt(t *testing.T) {
+	p := Create(lexer.Create(`let x = 5;`))
+
+	expected := []string{"x", "=", "5", ";", ""}
+	for i, literal := range expected {
+		if tok := p.peekTokenAt(i + 1); tok.Literal != literal {
+			t.Errorf("peekTokenAt(%d) wrong. want=%q, got=%q", i+1, literal, tok.Literal)
+		}
+	}
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if program.String() != "let x = 5;" {
+		t.Errorf("looking ahead changed the program, got=%q", program.String())
 	}
 }
 
@@ -2,38 +2,70 @@ package parser
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
+
+	"alde.nu/mint/token"
 )
 
-var traceLevel int = 0
+type TraceKind int
+
+const (
+	TraceEnter TraceKind = iota
+	TraceExit
+)
+
+func (k TraceKind) String() string {
+	if k == TraceEnter {
+		return "BEGIN"
+	}
+	return "END"
+}
 
-const traceIdentPlaceholder string = "\t"
+// TraceEvent is reported when the parser enters or leaves one of its
+// parse functions.
+type TraceEvent struct {
+	Kind  TraceKind
+	Rule  string      // the parse function, such as "parseLetStatement"
+	Token token.Token // the current token
+	Depth int         // 1 for the outermost rule
+}
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+func (e TraceEvent) String() string {
+	return fmt.Sprintf("%s%s %s (%s %s %q)", strings.Repeat("\t", e.Depth-1),
+		e.Kind, e.Rule, e.Token.Pos, e.Token.Type, e.Token.Literal)
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
+type Option func(*Parser)
+
+// WithTraceFunc calls fn for every rule the parser enters and leaves.
+func WithTraceFunc(fn func(TraceEvent)) Option {
+	return func(p *Parser) {
+		p.tracer = fn
+	}
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+// WithTrace writes every rule the parser enters and leaves to w, one
+// indented line per event.
+func WithTrace(w io.Writer) Option {
+	return WithTraceFunc(func(e TraceEvent) {
+		fmt.Fprintln(w, e)
+	})
+}
 
-func trace(msg string) string {
-	if _, ok := os.LookupEnv("TRACE_PARSER"); !ok {
-		return ""
+func (p *Parser) trace(rule string) string {
+	if p.tracer == nil {
+		return rule
 	}
-	incIdent()
-	tracePrint("BEGIN " + msg)
-	return msg
+	p.traceDepth++
+	p.tracer(TraceEvent{Kind: TraceEnter, Rule: rule, Token: p.currentToken, Depth: p.traceDepth})
+	return rule
 }
 
-func untrace(msg string) {
-	if _, ok := os.LookupEnv("TRACE_PARSER"); !ok {
+func (p *Parser) untrace(rule string) {
+	if p.tracer == nil {
 		return
 	}
-	tracePrint("END " + msg)
-	decIdent()
+	p.tracer(TraceEvent{Kind: TraceExit, Rule: rule, Token: p.currentToken, Depth: p.traceDepth})
+	p.traceDepth--
 }
@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
 	"alde.nu/mint/compiler"
+	"alde.nu/mint/evalutator"
 	"alde.nu/mint/lexer"
+	"alde.nu/mint/object"
 	"alde.nu/mint/parser"
 	"alde.nu/mint/vm"
 	"github.com/fatih/color"
@@ -23,6 +26,17 @@ var (
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	num := 0
+	// Every line entered, numbered from 1 in the positions of errors
+	history := []string{}
+
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	macroEnv := object.CreateEnvironment()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
 	for {
 		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
@@ -36,6 +50,8 @@ func Start(in io.Reader, out io.Writer) {
 			break
 		}
 		l := lexer.Create(line)
+		l.StartAtLine(len(history) + 1)
+		history = append(history, line)
 		p := parser.Create(l)
 		program := p.ParseProgram()
 
@@ -43,29 +59,47 @@ func Start(in io.Reader, out io.Writer) {
 			printParserErrors(out, p.Errors())
 			continue
 		}
+		for _, msg := range p.Warnings() {
+			io.WriteString(out, yellow(fmt.Sprintf("warning: %s\n", msg)))
+		}
 
-		comp := compiler.New()
-		err := comp.Compile(program)
+		evalutator.DefineMacros(program, macroEnv)
+		expanded, err := evalutator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, red(fmt.Sprintf("Woops! Macro expansion failed:\n%s\n", err)))
+			continue
+		}
+
+		comp := compiler.NewWithState(symbolTable, constants)
+		err = comp.Compile(expanded)
 		if err != nil {
 			io.WriteString(out, red(fmt.Sprintf("Woops! Compilation failed:\n%s\n", err)))
 			continue
 		}
 
-		machine := vm.New(comp.Bytecode())
+		code := comp.Bytecode()
+		constants = code.Constants
+
+		machine := vm.NewWithGlobalsStore(code, globals)
 		err = machine.Run()
 		if err != nil {
-			io.WriteString(out, red(fmt.Sprintf("Woops! Executing bytecode failed:\n%s\n", err)))
+			io.WriteString(out, red("Woops! Executing bytecode failed:\n"))
+			if thrown, ok := err.(*object.Error); ok {
+				io.WriteString(out, red(FormatError(strings.Join(history, "\n"), thrown)))
+			} else {
+				io.WriteString(out, red(fmt.Sprintf("%s\n", err)))
+			}
 			continue
 		}
 
-		stackTop := machine.StackTop()
+		lastPopped := machine.LastPoppedStackElem()
 
-		if stackTop != nil {
+		if lastPopped != nil {
 			num += 1
 
 			index := fmt.Sprintf("%s%s%s ", green("["), yellow(num), green("]"))
 			io.WriteString(out, index)
-			io.WriteString(out, stackTop.Inspect())
+			io.WriteString(out, lastPopped.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
@@ -0,0 +1,56 @@
+package repl
+
+import (
+	"fmt"
+	"strings"
+
+	"alde.nu/mint/object"
+)
+
+// FormatError renders an error that reached the top of a program run from
+// source: its message, the line it was raised on with a caret under the
+// column, and the functions it was thrown through.
+func FormatError(source string, err *object.Error) string {
+	var out strings.Builder
+	out.WriteString(err.Inspect())
+	out.WriteString("\n")
+
+	trace := err.Trace()
+	if excerpt := sourceExcerpt(source, trace[0]); excerpt != "" {
+		out.WriteString(excerpt)
+	}
+	for i, frame := range trace {
+		if i == len(err.Stack) && err.Omitted > 0 {
+			fmt.Fprintf(&out, "  ... %d more\n", err.Omitted)
+		}
+		fmt.Fprintf(&out, "  at %s\n", frame)
+	}
+	return out.String()
+}
+
+// sourceExcerpt is the line frame is at, prefixed with its number, and a
+// caret under its column. Tabs before the column are kept so the caret
+// lines up however wide they are shown.
+func sourceExcerpt(source string, frame object.StackFrame) string {
+	lines := strings.Split(source, "\n")
+	if frame.Pos.Line < 1 || frame.Pos.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[frame.Pos.Line-1], "\r")
+
+	var indent strings.Builder
+	for i, r := range []rune(line) {
+		if i >= frame.Pos.Column-1 {
+			break
+		}
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+
+	number := fmt.Sprint(frame.Pos.Line)
+	gutter := strings.Repeat(" ", len(number))
+	return fmt.Sprintf("  %s | %s\n  %s | %s^\n", number, line, gutter, indent.String())
+}
@@ -0,0 +1,45 @@
+package repl
+
+import (
+	"testing"
+
+	"alde.nu/mint/object"
+	"alde.nu/mint/token"
+)
+
+func Test_FormatError(t *testing.T) {
+	source := "let f = fn() {\n\tx + 1\n};\nf();"
+	err := &object.Error{
+		Message: "identifier not found: x",
+		Pos:     token.Position{Line: 4, Column: 2},
+		Stack:   []object.StackFrame{{Function: "f", Pos: token.Position{Line: 2, Column: 2}}},
+	}
+
+	expected := `ERROR: identifier not found: x
+  2 | 	x + 1
+    | 	^
+  at f (2:2)
+  at <main> (4:2)
+`
+	if got := FormatError(source, err); got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func Test_FormatErrorWithoutPosition(t *testing.T) {
+	err := &object.Error{Message: "boom", Stack: []object.StackFrame{{Function: "f"}}}
+
+	expected := "ERROR: boom\n  at f\n  at <main>\n"
+	if got := FormatError("f()", err); got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func Test_FormatErrorOmittedFrames(t *testing.T) {
+	err := &object.Error{Message: "boom", Stack: []object.StackFrame{{Function: "f"}}, Omitted: 3}
+
+	expected := "ERROR: boom\n  at f\n  ... 3 more\n  at <main>\n"
+	if got := FormatError("f()", err); got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, got)
+	}
+}
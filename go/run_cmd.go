@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"alde.nu/mint/compiler"
+	"alde.nu/mint/evalutator"
+	"alde.nu/mint/lexer"
+	"alde.nu/mint/object"
+	"alde.nu/mint/parser"
+	"alde.nu/mint/repl"
+	"alde.nu/mint/vm"
+)
+
+// runRun implements `mint run [-eval] [-stats] [-case-fold-warnings]
+// [-escape-warnings] [limits] [path]`, running the program in path or in standard input on
+// the VM, or with the evaluator. Errors that reach the top are printed
+// with the line they were raised on, warnings once the program is done.
+func runRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	useEval := flags.Bool("eval", false, "run with the evaluator instead of the VM")
+	timeout := flags.Duration("timeout", 0, "stop the program after this long, 0 for no limit")
+	maxSteps := flags.Int("max-steps", 0, "stop the program after this many steps, 0 for no limit")
+	maxMemory := flags.Int64("max-memory", 0, "stop the program once the values it can still reach take this many bytes, 0 for no limit")
+	stats := flags.Bool("stats", false, "print how much memory the program allocated and had in use at most")
+	caseFold := flags.Bool("case-fold-warnings", false, "warn about string comparisons that used to ignore case")
+	escapes := flags.Bool("escape-warnings", false, "warn about escapes in strings, which were kept as written before")
+	src, status := openSource(flags, "[-eval] [-stats] [-case-fold-warnings] [-escape-warnings] [-timeout d] [-max-steps n] [-max-memory n] [path]", args)
+	if status != 0 {
+		return status
+	}
+	defer src.Close()
+
+	// The whole source is kept to show the lines errors come from
+	source, err := io.ReadAll(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mint run: %s\n", err)
+		return 1
+	}
+
+	l := lexer.Create(string(source))
+	if *escapes {
+		l.WarnChangedEscapes()
+	}
+	p := parser.Create(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "mint run: %s\n", msg)
+		}
+		return 1
+	}
+	for _, msg := range append(l.Warnings(), p.Warnings()...) {
+		fmt.Fprintf(os.Stderr, "mint run: warning: %s\n", msg)
+	}
+
+	macroEnv := object.CreateEnvironment()
+	evalutator.DefineMacros(program, macroEnv)
+	limits := []evalutator.Option{
+		evalutator.WithTimeout(*timeout),
+		evalutator.WithStepLimit(*maxSteps),
+		evalutator.WithMemoryLimit(*maxMemory),
+	}
+	expanded, err := evalutator.ExpandMacros(program, macroEnv, limits...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mint run: %s\n", err)
+		return 1
+	}
+
+	if *useEval {
+		opts := limits
+		if *caseFold {
+			opts = append(opts, evalutator.WithCaseFoldWarnings())
+		}
+		e := evalutator.New(opts...)
+		result := e.Eval(expanded, object.CreateEnvironment())
+		printWarnings(e.Warnings())
+		if *stats {
+			printMemoryStats(e.MemoryStats())
+		}
+		switch result := result.(type) {
+		case *object.Error:
+			fmt.Fprint(os.Stderr, repl.FormatError(string(source), result))
+			return 1
+		case *object.LimitError:
+			fmt.Fprintf(os.Stderr, "mint run: %s\n", result)
+			return 1
+		}
+		return 0
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(expanded); err != nil {
+		fmt.Fprintf(os.Stderr, "mint run: %s\n", err)
+		return 1
+	}
+	opts := []vm.Option{
+		vm.WithTimeout(*timeout),
+		vm.WithStepLimit(*maxSteps),
+		vm.WithMemoryLimit(*maxMemory),
+	}
+	if *caseFold {
+		opts = append(opts, vm.WithCaseFoldWarnings())
+	}
+	machine := vm.New(comp.Bytecode(), opts...)
+	err = machine.Run()
+	printWarnings(machine.Warnings())
+	if *stats {
+		printMemoryStats(machine.MemoryStats())
+	}
+	if err != nil {
+		if thrown, ok := err.(*object.Error); ok {
+			fmt.Fprint(os.Stderr, repl.FormatError(string(source), thrown))
+		} else {
+			fmt.Fprintf(os.Stderr, "mint run: %s\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func printWarnings(warnings []object.Warning) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "mint run: warning: %s\n", w)
+	}
+}
+
+func printMemoryStats(stats object.MemoryStats) {
+	fmt.Fprintf(os.Stderr, "mint run: %d allocations, %d bytes allocated, peak memory %d bytes\n", stats.Allocations, stats.AllocatedBytes, stats.PeakBytes)
+}
@@ -1,20 +1,41 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
+// Position is the location of a token in the source. Lines and columns
+// start at 1, columns count characters rather than bytes.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Pos     Position  `json:"pos"`
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"if":      IF,
+	"else":    ELSE,
+	"true":    TRUE,
+	"false":   FALSE,
+	"return":  RETURN,
+	"null":    NULL,
+	"match":   MATCH,
+	"macro":   MACRO,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
 }
 
 func LookupIdentifier(identifier string) TokenType {
@@ -33,21 +54,37 @@ const (
 	INT   = "INT"
 
 	// Operators
-	ASSIGN   = "="
-	MINUS    = "-"
-	PLUS     = "+"
-	SLASH    = "/"
-	GT       = ">"
-	LT       = "<"
-	BANG     = "!"
-	ASTERISK = "*"
-	EQ       = "=="
-	NOT_EQ   = "!="
+	ASSIGN    = "="
+	MINUS     = "-"
+	PLUS      = "+"
+	SLASH     = "/"
+	GT        = ">"
+	LT        = "<"
+	BANG      = "!"
+	ASTERISK  = "*"
+	PERCENT   = "%"
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	TILDE     = "~"
+	EQ        = "=="
+	NOT_EQ    = "!="
+	LT_EQ     = "<="
+	GT_EQ     = ">="
+	POWER     = "**"
+	LSHIFT    = "<<"
+	RSHIFT    = ">>"
+	AND       = "&&"
+	OR        = "||"
+	NULLISH   = "??"
+	OPTIONAL  = "?."
 
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..."
+	ARROW     = "=>"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -64,5 +101,19 @@ const (
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	RETURN   = "RETURN"
+	NULL     = "NULL"
+	MATCH    = "MATCH"
+	MACRO    = "MACRO"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 	STRING   = "STRING"
+	// An interpolated string is split into its text parts around the
+	// expressions: STRING_HEAD up to the first ${, STRING_MID between
+	// two of them and STRING_TAIL after the last one
+	STRING_HEAD = "STRING_HEAD"
+	STRING_MID  = "STRING_MID"
+	STRING_TAIL = "STRING_TAIL"
+	COMMENT     = "COMMENT"
 )
@@ -0,0 +1,27 @@
+package vm
+
+import (
+	"alde.nu/mint/code"
+	"alde.nu/mint/object"
+	"alde.nu/mint/token"
+)
+
+// Frame is the call frame of a single function invocation.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int // stack pointer before the call, locals start here
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// Position is the source position of the instruction being executed.
+func (f *Frame) Position() token.Position {
+	return f.cl.Fn.Positions.Lookup(f.ip)
+}
@@ -0,0 +1,24 @@
+package vm
+
+import (
+	"testing"
+
+	"alde.nu/mint/internal/hashtest"
+)
+
+func Test_HashIndexWithCollisions(t *testing.T) {
+	restore := hashtest.ForceCollisions()
+	defer restore()
+
+	tests := []vmTestCase{
+		{`{"a": 1, "b": 2}["a"]`, 1},
+		{`{"a": 1, "b": 2}["b"]`, 2},
+		{`{"a": 1, "b": 2}["c"]`, Null},
+		{`{"a": 1, 1: 2, true: 3}[true]`, 3},
+		{"{[1, 2]: 1, [2, 1]: 2}[[2, 1]]", 2},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1, "b": 2} == {"a": 2, "b": 1}`, false},
+	}
+
+	runVmTests(t, tests)
+}
@@ -1,31 +1,169 @@
 package vm
 
 import (
-	"fmt"
+	"context"
+	"time"
 
 	"alde.nu/mint/code"
 	"alde.nu/mint/compiler"
 	"alde.nu/mint/object"
 )
 
+// StackSize and MaxFrames are the sizes of the value stack and the call
+// stack, unless WithStackSize and WithMaxFrames say otherwise.
 const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = &object.Null{}
+)
+
+// operators maps opcodes back to their source operator, used to give
+// errors the same shape as the evaluator's.
+var operators = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpMod:                "%",
+	code.OpPow:                "**",
+	code.OpBitAnd:             "&",
+	code.OpBitOr:              "|",
+	code.OpBitXor:             "^",
+	code.OpShiftLeft:          "<<",
+	code.OpShiftRight:         ">>",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+	code.OpGreaterThan:        ">",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThan:           "<",
+	code.OpLessThanOrEqual:    "<=",
+	code.OpMinus:              "-",
+	code.OpBang:               "!",
+	code.OpBitNot:             "~",
+}
 
 type VM struct {
-	constants    []object.Object
-	instructions code.Instructions
+	constants []object.Object
 
 	stack []object.Object
 	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	globals     []object.Object
+	globalsUsed int // the globals past it haven't been set
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // the exception handler table, innermost last
+
+	stepLimit   int
+	timeout     time.Duration
+	memoryLimit int64
+	steps       object.Steps
+	memory      object.Memory
+
+	caseFold *object.CaseFoldWarnings // nil unless WithCaseFoldWarnings
+}
+
+type Option func(*VM)
+
+// WithStackSize sets how many values the stack holds. Arguments and locals
+// of every call in progress live there.
+func WithStackSize(size int) Option {
+	return func(vm *VM) {
+		vm.stack = make([]object.Object, size)
+	}
+}
+
+// WithMaxFrames sets how many calls can be in progress at once, counting
+// the program itself.
+func WithMaxFrames(frames int) Option {
+	return func(vm *VM) {
+		main := vm.frames[0]
+		vm.frames = make([]*Frame, frames)
+		vm.frames[0] = main
+	}
+}
+
+// WithCaseFoldWarnings makes the VM record a Warning for every string
+// comparison whose result changed when `==` and `!=` stopped ignoring
+// case, like the evaluator's option of the same name.
+func WithCaseFoldWarnings() Option {
+	return func(vm *VM) {
+		vm.caseFold = &object.CaseFoldWarnings{}
+	}
+}
+
+// handler is an entry of the exception handler table, added by OpTry or
+// OpTryFinally.
+type handler struct {
+	ip          int // where the handler starts
+	framesIndex int // the frames and the stack to go back to
+	sp          int
+	finally     bool // added by OpTryFinally
+}
+
+// WithStepLimit stops a run once it has executed more than steps
+// instructions, with an *object.LimitError.
+func WithStepLimit(steps int) Option {
+	return func(vm *VM) {
+		vm.stepLimit = steps
+	}
+}
+
+// WithTimeout stops a run once it has taken longer than timeout, with an
+// *object.LimitError.
+func WithTimeout(timeout time.Duration) Option {
+	return func(vm *VM) {
+		vm.timeout = timeout
+	}
 }
 
-func New(bytecode *compiler.Bytecode) *VM {
-	return &VM{
-		constants:    bytecode.Constants,
-		instructions: bytecode.Instructions,
+// WithMemoryLimit stops a run once the arrays, strings and hashes it
+// built take more than bytes, with an *object.LimitError. See
+// object.Memory for how they are counted.
+func WithMemoryLimit(bytes int64) Option {
+	return func(vm *VM) {
+		vm.memoryLimit = bytes
+	}
+}
+
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	vm := &VM{
+		constants: bytecode.Constants,
 
 		stack: make([]object.Object, StackSize),
 		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
 	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	return vm
+}
+
+// NewWithGlobalsStore creates a VM sharing its globals with an earlier
+// run, which is what keeps definitions alive between REPL lines.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object, opts ...Option) *VM {
+	vm := New(bytecode, opts...)
+	vm.globals = s
+	vm.globalsUsed = len(s) // which the earlier runs set isn't known
+	return vm
 }
 
 func (vm *VM) StackTop() object.Object {
@@ -36,33 +174,760 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// LastPoppedStackElem returns the value of the last expression statement.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run executes the bytecode. An error stops it unless a try expression
+// catches it, in which case it carries on in the handler.
 func (vm *VM) Run() error {
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		op := code.Opcode(vm.instructions[ip])
+	return vm.RunContext(context.Background())
+}
+
+// RunContext executes the bytecode like Run, stopping with an
+// *object.LimitError when ctx is done or the run goes past the VM's
+// limits. Try expressions don't catch those.
+func (vm *VM) RunContext(ctx context.Context) error {
+	if vm.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vm.timeout)
+		defer cancel()
+	}
+
+	vm.steps = object.NewSteps(ctx, vm.stepLimit)
+	vm.memory = object.NewMemory(vm.memoryLimit, vm.inUse)
+	for {
+		err := vm.run()
+		if err == nil {
+			return nil
+		}
+		if limit, ok := err.(*object.LimitError); ok {
+			return limit
+		}
+		if err := vm.throw(err); err != nil {
+			return err
+		}
+	}
+}
+
+// MemoryStats reports the memory allocated by the last run.
+func (vm *VM) MemoryStats() object.MemoryStats {
+	return vm.memory.Stats()
+}
+
+// Warnings returns the warnings recorded so far, one per source location.
+func (vm *VM) Warnings() []object.Warning {
+	return vm.caseFold.Warnings()
+}
+
+// throw unwinds the frames up to the innermost handler, adding them to the
+// error's stack, and pushes the caught error for the handler, or the error
+// itself for a finally block. Without a
+// handler it unwinds everything and returns the error, which ends the run.
+func (vm *VM) throw(err error) error {
+	thrown, ok := err.(*object.Error)
+	if !ok {
+		thrown = &object.Error{Message: err.Error(), Kind: object.PlainError}
+	}
+	thrown.Locate(vm.currentFrame().Position())
+
+	if len(vm.handlers) == 0 {
+		vm.unwindFrames(thrown, 1)
+		return thrown
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.unwindFrames(thrown, h.framesIndex)
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+	if h.finally {
+		return vm.push(thrown)
+	}
+	if thrown.Value != nil {
+		return vm.push(thrown.Caught())
+	}
+	// Only the hash a runtime error is caught as is new
+	return vm.pushAllocated(thrown.Caught())
+}
+
+func (vm *VM) unwindFrames(thrown *object.Error, framesIndex int) {
+	for vm.framesIndex > framesIndex {
+		fn := vm.popFrame().cl.Fn
+		thrown.Unwind(fn.Name, vm.currentFrame().Position())
+	}
+}
+
+func (vm *VM) run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.steps.Take(); err != nil {
+			return err
+		}
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
 
 		switch op {
-		case code.OpAdd:
-			r := vm.pop()
-			rv := r.(*object.Integer).Value
-			l := vm.pop()
-			lv := l.(*object.Integer).Value
-			res := lv + rv
-			vm.push(&object.Integer{Value: res})
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual,
+			code.OpLessThan, code.OpLessThanOrEqual:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+		case code.OpMinus, code.OpBitNot:
+			if err := vm.executeIntegerPrefixOperation(op); err != nil {
+				return err
+			}
+		case code.OpBang:
+			operand := vm.pop()
+			if err := vm.push(object.NativeBool(!object.IsTruthy(operand))); err != nil {
+				return err
+			}
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpPop:
+			vm.pop()
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !object.IsTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpJumpNotTruthyOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !object.IsTruthy(vm.StackTop()) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpTruthyOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if object.IsTruthy(vm.StackTop()) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpNotNullOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isNull(vm.StackTop()) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if isNull(vm.StackTop()) {
+				vm.currentFrame().ip = pos - 1
+			}
 		case code.OpConstant:
-			constIndex := code.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
 
 			if err := vm.push(vm.constants[constIndex]); err != nil {
 				return err
 			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+			if int(globalIndex) >= vm.globalsUsed {
+				vm.globalsUsed = int(globalIndex) + 1
+			}
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.globals[globalIndex]); err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := object.Builtins[builtinIndex]
+			if err := vm.push(definition.Builtin); err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			if err := vm.push(currentClosure.Free[freeIndex]); err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.pushAllocated(array); err != nil {
+				return err
+			}
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := vm.buildInterpolatedString(vm.sp-numParts, vm.sp)
+			vm.sp = vm.sp - numParts
+
+			if err := vm.pushAllocated(str); err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.pushAllocated(hash); err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeSliceExpression(left, low, high); err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeTailCall(int(numArgs)); err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{ip: pos, framesIndex: vm.framesIndex, sp: vm.sp})
+		case code.OpTryFinally:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{ip: pos, framesIndex: vm.framesIndex, sp: vm.sp, finally: true})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			return object.Thrown(vm.pop())
+		case code.OpRethrow:
+			return vm.pop().(*object.Error)
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+		case code.OpDestructureArray:
+			numElements := code.ReadUint16(ins[ip+1:])
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			values, err := object.DestructureArray(vm.pop(), int(numElements), rest)
+			if err != nil {
+				return err
+			}
+			if err := vm.pushDestructured(values); err != nil {
+				return err
+			}
+		case code.OpDestructureHash:
+			keysIndex := code.ReadUint16(ins[ip+1:])
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			keyObjects := vm.constants[keysIndex].(*object.Array).Elements
+			keys := make([]string, len(keyObjects))
+			for i, key := range keyObjects {
+				keys[i] = key.(*object.String).Value
+			}
+
+			values, err := object.DestructureHash(vm.pop(), keys, rest)
+			if err != nil {
+				return err
+			}
+			if err := vm.pushDestructured(values); err != nil {
+				return err
+			}
+		case code.OpMatch:
+			patternIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.executeMatch(int(patternIndex)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (vm *VM) executeMatch(patternIndex int) error {
+	pattern := vm.constants[patternIndex].(*object.MatchPattern)
+
+	values, ok := object.Match(pattern.Pattern, vm.StackTop())
+	if !ok {
+		return vm.push(False)
+	}
+	if err := vm.pushDestructured(values); err != nil {
+		return err
+	}
+	return vm.push(True)
+}
+
+// pushDestructured pushes values in reverse, so the variables of a pattern
+// can be set in order by popping them off one by one.
+func (vm *VM) pushDestructured(values []object.Object) error {
+	for i := len(values) - 1; i >= 0; i-- {
+		if err := vm.push(values[i]); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return object.NewError(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return object.NewError(object.TypeError, "wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	// Checking for room for everything the call will push makes running
+	// out of stack an error of the call, like it is in the evaluator,
+	// rather than of whichever push inside it comes last
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if vm.framesIndex >= len(vm.frames) || frame.basePointer+cl.Fn.NumLocals+cl.Fn.MaxStack > len(vm.stack) {
+		return object.NewRecursionError()
+	}
+
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// executeTailCall calls a closure in the frame of the function calling
+// it, which has nothing left to do but return its value. The callee and
+// arguments move down to where the caller's were. Builtins don't take a
+// frame and are called like with OpCall.
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		return vm.executeCall(numArgs)
+	}
+	if numArgs != cl.Fn.NumParameters {
+		return object.NewError(object.TypeError, "wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := vm.currentFrame()
+	if frame.basePointer+cl.Fn.NumLocals+cl.Fn.MaxStack > len(vm.stack) {
+		return object.NewRecursionError()
+	}
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+
+	frame.cl = cl
+	frame.ip = -1
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	if result == nil {
+		return vm.push(Null)
+	}
+	if builtin.ReturnsArgument {
+		return vm.push(result)
+	}
+	return vm.pushAllocated(result)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return object.NewError(object.TypeError, "not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// buildInterpolatedString expects the text parts of the string at even
+// offsets from startIndex and the values between them at odd ones.
+func (vm *VM) buildInterpolatedString(startIndex, endIndex int) object.Object {
+	strings := []string{}
+	values := []object.Object{}
+
+	for i := startIndex; i < endIndex; i++ {
+		if (i-startIndex)%2 == 0 {
+			strings = append(strings, vm.stack[i].(*object.String).Value)
+		} else {
+			values = append(values, vm.stack[i])
+		}
+	}
+
+	return object.Interpolate(strings, values)
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := object.HashKeyOf(key)
+		if !ok {
+			return nil, object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+		hash.SetHashed(hashKey, key, value)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return object.NewError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i, ok := object.ElementIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
+
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+// executeStringIndex indexes by character rather than by byte
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	runes := []rune(str.(*object.String).Value)
+	i, ok := object.ElementIndex(index.(*object.Integer).Value, len(runes))
+
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.pushAllocated(&object.String{Value: string(runes[i])})
+}
+
+func (vm *VM) executeSliceExpression(left, low, high object.Object) error {
+	var bounds [2]*int64
+	for i, bound := range []object.Object{low, high} {
+		switch bound := bound.(type) {
+		case *object.Null:
+		case *object.Integer:
+			bounds[i] = &bound.Value
+		default:
+			return object.NewError(object.TypeError, "slice bounds must be INTEGER, got %s", bound.Type())
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		start, end := object.SliceBounds(bounds[0], bounds[1], len(left.Elements))
+		elements := make([]object.Object, end-start)
+		copy(elements, left.Elements[start:end])
+		return vm.pushAllocated(&object.Array{Elements: elements})
+	case *object.String:
+		runes := []rune(left.Value)
+		start, end := object.SliceBounds(bounds[0], bounds[1], len(runes))
+		return vm.pushAllocated(&object.String{Value: string(runes[start:end])})
+	default:
+		return object.NewError(object.TypeError, "slice operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := object.HashKeyOf(index)
+	if !ok {
+		return object.NewError(object.TypeError, "unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hashObject.GetHashed(key, index)
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(value)
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if vm.caseFold != nil {
+		vm.caseFold.Check(vm.currentFrame().Position(), operators[op], left, right)
+	}
+
+	switch {
+	case op == code.OpEqual:
+		return vm.push(object.NativeBool(object.Equals(left, right)))
+	case op == code.OpNotEqual:
+		return vm.push(object.NativeBool(!object.Equals(left, right)))
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case left.Type() != right.Type():
+		return object.NewError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operators[op], right.Type())
+	default:
+		return object.NewError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	var result int64
+	switch op {
+	case code.OpAdd:
+		result = leftVal + rightVal
+	case code.OpSub:
+		result = leftVal - rightVal
+	case code.OpMul:
+		result = leftVal * rightVal
+	case code.OpDiv:
+		if rightVal == 0 {
+			return object.NewError(object.ArithmeticError, "division by zero: %d / %d", leftVal, rightVal)
+		}
+		result = leftVal / rightVal
+	case code.OpMod:
+		if rightVal == 0 {
+			return object.NewError(object.ArithmeticError, "division by zero: %d %% %d", leftVal, rightVal)
+		}
+		result = leftVal % rightVal
+	case code.OpPow:
+		if rightVal < 0 {
+			return object.NewError(object.ArithmeticError, "negative exponent: %d ** %d", leftVal, rightVal)
+		}
+		result = object.IntegerPow(leftVal, rightVal)
+	case code.OpBitAnd:
+		result = leftVal & rightVal
+	case code.OpBitOr:
+		result = leftVal | rightVal
+	case code.OpBitXor:
+		result = leftVal ^ rightVal
+	case code.OpShiftLeft:
+		if rightVal < 0 {
+			return object.NewError(object.ArithmeticError, "negative shift count: %d << %d", leftVal, rightVal)
+		}
+		result = leftVal << rightVal
+	case code.OpShiftRight:
+		if rightVal < 0 {
+			return object.NewError(object.ArithmeticError, "negative shift count: %d >> %d", leftVal, rightVal)
+		}
+		result = leftVal >> rightVal
+	case code.OpGreaterThan:
+		return vm.push(object.NativeBool(leftVal > rightVal))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(object.NativeBool(leftVal >= rightVal))
+	case code.OpLessThan:
+		return vm.push(object.NativeBool(leftVal < rightVal))
+	case code.OpLessThanOrEqual:
+		return vm.push(object.NativeBool(leftVal <= rightVal))
+	default:
+		return object.NewError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	return vm.push(&object.Integer{Value: result})
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.pushAllocated(&object.String{Value: leftVal + rightVal})
+	case code.OpGreaterThan:
+		return vm.push(object.NativeBool(leftVal > rightVal))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(object.NativeBool(leftVal >= rightVal))
+	case code.OpLessThan:
+		return vm.push(object.NativeBool(leftVal < rightVal))
+	case code.OpLessThanOrEqual:
+		return vm.push(object.NativeBool(leftVal <= rightVal))
+	default:
+		return object.NewError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeIntegerPrefixOperation(op code.Opcode) error {
+	operand := vm.pop()
+
+	if operand.Type() != object.INTEGER_OBJ {
+		return object.NewError(object.TypeError, "unknown operator: %s%s", operators[op], operand.Type())
+	}
+
+	value := operand.(*object.Integer).Value
+	if op == code.OpBitNot {
+		return vm.push(&object.Integer{Value: ^value})
+	}
+	return vm.push(&object.Integer{Value: -value})
+}
+
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		// Calls check there is room for what they push before they
+		// start, so this is only a backstop. With calls in progress it's
+		// still their locals and arguments that filled the stack.
+		if vm.framesIndex > 1 {
+			return object.NewRecursionError()
+		}
+		return object.NewError(object.PlainError, "stack overflow")
 	}
 
 	vm.stack[vm.sp] = o
@@ -71,9 +936,33 @@ func (vm *VM) push(o object.Object) error {
 	return nil
 }
 
+// inUse measures the memory the values on the stack, in the globals and
+// in the closures being run take.
+func (vm *VM) inUse() int64 {
+	closures := make([]object.Object, vm.framesIndex)
+	for i, frame := range vm.frames[:vm.framesIndex] {
+		closures[i] = frame.cl
+	}
+	return object.InUse(nil, vm.stack[:vm.sp], vm.globals[:vm.globalsUsed], closures)
+}
+
+// pushAllocated pushes obj, a value that was just built, after counting it
+// against the memory limit.
+func (vm *VM) pushAllocated(obj object.Object) error {
+	if err := vm.memory.Allocate(obj); err != nil {
+		return err
+	}
+	return vm.push(obj)
+}
+
 func (vm *VM) pop() object.Object {
 	o := vm.stack[vm.sp-1]
 	vm.sp--
 
 	return o
 }
+
+func isNull(obj object.Object) bool {
+	_, ok := obj.(*object.Null)
+	return ok
+}
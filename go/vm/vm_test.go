@@ -1,8 +1,12 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"alde.nu/mint/ast"
 	"alde.nu/mint/compiler"
@@ -21,6 +25,834 @@ func Test_IntegerArithmetic(t *testing.T) {
 		{"1", 1},
 		{"2", 2},
 		{"1+2", 3},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"-7 / 2", -3},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"0 ** 0", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"~-1", 0},
+		{"1 << 4", 16},
+		{"-1 << 3", -8},
+		{"256 >> 4", 16},
+		{"-8 >> 1", -4},
+		{"-1 >> 63", -1},
+		{"1 << 64", 0},
+		{"1 | 2 ^ 3 & 4", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_BooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == false", true},
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!5", true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"abc" > "abd"`, false},
+		{`"ab" < "abc"`, true},
+		{`"a" <= "a"`, true},
+		{`"b" >= "a"`, true},
+		{`"B" < "a"`, true},
+		{`"admin" == "admin"`, true},
+		{`"Admin" == "admin"`, false},
+		{`"Admin" != "admin"`, true},
+		{`"admin" != "admin"`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_StringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mint"`, "mint"},
+		{`"mi" + "nt"`, "mint"},
+		{`"mi" + "nt" + "y"`, "minty"},
+		{`let name = "mint"; let items = [1, 2]; "Hello ${name}, you have ${len(items)} items"`, "Hello mint, you have 2 items"},
+		{`"${1 + 2}${true}${null}"`, "3truenull"},
+		{`let x = "in"; "out ${ "in ${x}" } out"`, "out in in out"},
+		{`"\\${1}"`, "\\1"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_Conditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if (true) { }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_GlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_DestructuringLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a + b", 3},
+		{"let [a, ...rest] = [1, 2, 3]; rest", []int{2, 3}},
+		{"let [a, ...rest] = [1]; rest", []int{}},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{`let {name, age: years} = {"name": "ann", "age": 30}; name + "!"`, "ann!"},
+		{`let {a, ...others} = {"c": 3, "a": 1, "b": 2}; values(others)`, []int{3, 2}},
+		{`let {pos: [x, y]} = {"pos": [1, 2]}; x * 10 + y`, 12},
+		{"let f = fn(xs) { let [h, ...t] = xs; h + len(t) }; f([5, 6, 7])", 7},
+		{"let f = fn(p) { let {x, y} = p; fn() { x - y } }; f({\"x\": 5, \"y\": 2})()", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_MatchExpression(t *testing.T) {
+	describe := `let describe = fn(x) {
+		match (x) {
+			0 => "zero",
+			-1 => "minus one",
+			true => "yes",
+			null => "nothing",
+			n if type(n) == "INTEGER" && n > 100 => "big",
+			[] => "empty",
+			[1, ...rest] => "starts with 1, then " + type(rest),
+			{"kind": "point", x, y} => "point",
+			_ => "other",
+		}
+	};`
+
+	tests := []vmTestCase{
+		{describe + "describe(0)", "zero"},
+		{describe + "describe(-1)", "minus one"},
+		{describe + "describe(true)", "yes"},
+		{describe + "describe(false)", "other"},
+		{describe + "describe(null)", "nothing"},
+		{describe + "describe(101)", "big"},
+		{describe + "describe(100)", "other"},
+		{describe + "describe([])", "empty"},
+		{describe + "describe([1, 2, 3])", "starts with 1, then ARRAY"},
+		{describe + `describe({"kind": "point", "x": 1, "y": 2})`, "point"},
+		{describe + `describe({"x": 1})`, "other"},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c, _ => 0 }", 6},
+		{"let x = match (5) { n => n * 2 }; x", 10},
+		{"match (5) { 1 => 1 }", Null},
+		{"match (5) { n if n > 10 => 1, n if n > 1 => 2, _ => 3 }", 2},
+		{"let f = fn(xs) { match (xs) { [h, ...t] => h + len(t), _ => 0 } }; f([5, 6]) + f([])", 6},
+		{"let [_, b] = [1, 2]; b", 2},
+		{"1 + match (2) { _ => 3 }", 4},
+		{"let x = 10; match (3) { x => x }; x", 10},
+		{"let x = 10; match (3) { x => x }", 3},
+		{"let f = fn() { let x = 10; match (3) { x => x }; x }; f()", 10},
+		{"let x = 10; match ([1, 2]) { [x, y] if x < y => x + y, _ => 0 } + x", 13},
+		{"match (1) { 1 => { let a = 2; a + 1 }, _ => 0 }", 3},
+		{"let a = 5; match (1) { 1 => { let a = 2; a }, _ => 0 }; a", 5},
+		{"match ([1, 2]) { [a, b] if a < b => { let s = a + b; s * 2 }, _ => 0 }", 6},
+		{`let h = match (1) { 1 => {"a": 7}, _ => {} }; h["a"]`, 7},
+		{"let g = match (4) { n => fn() { n } }; g()", 4},
+		{"let f = fn(x) { match (x) { n => fn() { n + x } } }; f(2)()", 4},
+		{"match (1) { 1 => { let a = 2 } }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_ArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_HashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"{}", map[object.HashKey]int64{}},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_IndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", 1},
+		{"[1, 2, 3][-2]", 2},
+		{"[1][-2]", Null},
+		{`"abc"[1]`, "b"},
+		{`"héllo"[-4]`, "é"},
+		{`"abc"[3]`, Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{"let x = 1; let y = 2; {[x, y]: 5}[[1, 2]]", 5},
+		{"{[1, 2]: 5}[[2, 1]]", Null},
+		{`{{"a": 1, "b": 2}: 5}[{"b": 2, "a": 1}]`, 5},
+		{`{{"a": 1}: 5}[{"a": 2}]`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_SliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][5:]", []int{}},
+		{"let n = 1; [1, 2, 3, 4][n:n + 2]", []int{2, 3}},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[-3:]`, "llo"},
+		{`"héllo"[:2]`, "hé"},
+		{`len("héllo")`, 5},
+		{"null?.[1:]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_CallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let globalNum = 10; let minusOne = fn() { let num = 1; globalNum - num; }; minusOne();", 9},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_Closures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let newAdder = fn(x) { fn(y) { x + y }; };
+			let addTwo = newAdder(2);
+			addTwo(2);`,
+			4,
+		},
+		{
+			`let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) { let e = d + c; fn(f) { e + f; }; };
+			};
+			let newAdderInner = newAdderOuter(1, 2);
+			let adder = newAdderInner(3);
+			adder(8);`,
+			14,
+		},
+		{
+			`let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			countDown(10);`,
+			0,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let fibonacci = fn(x) {
+				if (x < 2) { return x; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);`,
+			610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_HashOrder(t *testing.T) {
+	tests := []vmTestCase{
+		{`keys({"c": 1, "a": 2, "b": 3}) == ["c", "a", "b"]`, true},
+		{`values({"c": 1, "a": 2, "b": 3})`, []int{1, 2, 3}},
+		{`values({"a": 1, "b": 2, "a": 3})`, []int{3, 2}},
+		{`keys({})`, []int{}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_BuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		// Changed: len counted bytes before indexing went by character,
+		// when these were 6, 6 and 8
+		{`len("héllo")`, 5},
+		{`len("日本")`, 2},
+		{`len("🙂🙂")`, 2},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`puts()`, Null},
+		{`equal_fold("Admin", "admin")`, true},
+		{`if (equal_fold("a", "b")) { 1 } else { 2 }`, 2},
+		{`lower("MiNt")`, "mint"},
+		{`upper("MiNt")`, "MINT"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_StructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{"[[1], [2]] == [[1], [2]]", true},
+		{`["a", true] == ["a", true]`, true},
+		{`[] == []`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{} != {}`, false},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+		{"let make = fn() { fn() { 1 } }; make() == make()", false},
+		{"len == len", true},
+		{"len == first", false},
+		{"1 == true", false},
+		{`1 != "1"`, true},
+		{"[1] == 1", false},
+		{"if (false) { 1 } == if (false) { 2 }", true},
+		{"fn() {}() == 1", false},
+		{"fn() {}() == null", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_RuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`"hello" - "world"`, "unknown operator: STRING - STRING"},
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"1 % 0", "division by zero: 1 % 0"},
+		{"2 ** -1", "negative exponent: 2 ** -1"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"1 >> -1", "negative shift count: 1 >> -1"},
+		{"1()", "not a function: INTEGER"},
+		{"fn(a) { a }()", "wrong number of arguments: want=1, got=0"},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`{[fn() {}]: 2}`, "unusable as hash key: ARRAY"},
+		{`{"a": 1}[fn() {}]`, "unusable as hash key: CLOSURE"},
+		{`null["a"]`, "index operator not supported: NULL"},
+		{"let [a, b] = [1]; a", "array pattern needs 2 elements, got 1"},
+		{"let [a, b, ...c] = [1]; a", "array pattern needs at least 2 elements, got 1"},
+		{"let [a] = 1; a", "cannot destructure INTEGER with an array pattern"},
+		{`let {a} = {"b": 1}; a`, `hash pattern key "a" not found`},
+		{"let {a} = [1]; a", "cannot destructure ARRAY with a hash pattern"},
+		{`"abc"[1:"b"]`, "slice bounds must be INTEGER, got STRING"},
+		{`{"a": 1}[0:1]`, "slice operator not supported: HASH"},
+		{"let f = null; f()", "not a function: NULL"},
+		{`{{"f": fn() {}}: 1}`, "unusable as hash key: HASH"},
+		{`1[0]`, "index operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q, got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q.\n\twant=%q\n\tgot=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func Test_TryExpression(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { e }`, "boom"},
+		{`try { 1 / 0 } catch (e) { "${e["kind"]}: ${e["message"]}" }`, "ArithmeticError: division by zero: 1 / 0"},
+		{`try { let [a] = 1 } catch (e) { e["kind"] }`, "PatternError"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { throw 1 } catch (e) { e + 1 }`, 2},
+		{`try { try { throw [1, 2] } catch (e) { throw e } } catch (e) { e[1] }`, 2},
+		{`try { throw {"code": 2} } catch (e) { "${e}" }`, "{code: 2}"},
+		{`try { try { 1 / 0 } catch (e) { throw e } } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`try { throw {"code": 2} } catch (e) { "${type(e["message"])} ${e["code"]}" }`, "NULL 2"},
+		{`try { len(1) } catch (e) { e["kind"] }`, "TypeError"},
+		{`let f = fn(x) { x }; try { f() } catch (e) { "${e["kind"]}: ${e["message"]}" }`, "TypeError: wrong number of arguments: want=1, got=0"},
+		{`try { [1][0:"a"] } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { 1 << -1 } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`try { throw {"kind": "ValueError", "message": "bad", "code": 7} } catch (e) { "${e["kind"]} ${e["message"]} ${e["code"]}" }`, "ValueError bad 7"},
+		{`let inner = fn() { 1 / 0 }; let outer = fn() { inner(); 1 }; try { outer() } catch (e) { "${e["stack"]}" }`, "[inner (1:22), outer (1:53)]"},
+		{`try { fn() { [][0] + 1 }() } catch (e) { "${e["stack"]}" }`, "[<anonymous> (1:20)]"},
+		{`let f = fn(x) { 10 + try { x / 0 } catch (e) { x } }; f(5)`, 15},
+		{`let f = fn() { throw "x" }; let g = fn() { try { f() } catch (e) { 1 } }; g() + g()`, 2},
+		{`try { 1 } finally { 2 }`, 1},
+		{`let x = 1; try { x } finally { let x = 2 }; x`, 2},
+		{`let x = 0; let r = try { throw 1 } catch (e) { 10 } finally { let x = 5 }; r + x`, 15},
+		{`let x = 0; let r = try { try { throw "in" } finally { let x = 1 } } catch (e) { e }; "${r} ${x}"`, "in 1"},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (e) { e }`, "a"},
+		{`let x = 0; let r = try { try { throw "a" } catch (e) { throw "b" } finally { let x = 1 } } catch (e) { e }; "${r} ${x}"`, "b 1"},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`let f = fn() { try { return 1 } finally { throw "f" } }; try { f() } catch (e) { e }`, "f"},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } }; let g = fn() { f(); throw "g" }; try { g() } catch (e) { e }`, "g"},
+		{`let count = fn(n) { if (n == 0) { return 0 }; try { count(n - 1) + 1 } catch (e) { -1 } }; count(20)`, 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_UncaughtThrow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "boom"`, "boom"},
+		{`throw 42`, "42"},
+		{`throw {"message": "m", "kind": "K"}`, "m"},
+		{`try { 1 } finally { throw "f" }`, "f"},
+		{`try { throw "a" } catch (e) { throw "b" }`, "b"},
+		{`let f = fn() { throw "x" }; f(); 1`, "x"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q, got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q.\n\twant=%q\n\tgot=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func Test_ErrorTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let inner = fn(x) {\n\tx / 0\n};\nlet outer = fn() { inner(1); 1 };\nouter();", "inner 2:4, outer 4:25, <main> 5:6"},
+		{"let inner = fn(x) {\n\tx / 0\n};\nlet outer = fn() { inner(1) };\nouter();", "inner 2:4, <main> 5:6"},
+		{"let f = fn() { len(1) };\n[f][0]()", "f 1:19, <main> 2:7"},
+		{"fn() { throw \"x\" }()", "<anonymous> 1:8, <main> 1:19"},
+		{"let f = fn() { 1 + true };\ntry { f() } catch (e) { throw e }", "f 1:18, <main> 2:25"},
+		{"let g = fn() { 1 + true };\nlet f = fn() { try { g() } finally { 1 } };\nf()", "g 1:18, f 2:23, <main> 3:2"},
+		{"let f = fn() { try { 1 + true } catch (e) { 1 / 0 } finally { 1 } };\nf()", "f 1:47, <main> 2:2"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		thrown, ok := err.(*object.Error)
+		if !ok {
+			t.Errorf("expected an *object.Error for %q, got %T (%v)", tt.input, err, err)
+			continue
+		}
+		frames := []string{}
+		for _, frame := range thrown.Trace() {
+			frames = append(frames, fmt.Sprintf("%s %s", frame.Function, frame.Pos))
+		}
+		if trace := strings.Join(frames, ", "); trace != tt.expected {
+			t.Errorf("wrong trace for %q. want=%q, got=%q", tt.input, tt.expected, trace)
+		}
+	}
+}
+
+func Test_RecursionLimit(t *testing.T) {
+	countdown := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };"
+	tests := []struct {
+		input    string
+		opts     []Option
+		expected interface{}
+	}{
+		{countdown + "f(8)", []Option{WithMaxFrames(10)}, 8},
+		{countdown + "f(9)", []Option{WithMaxFrames(10)}, object.RecursionMessage},
+		{countdown + "f(20)", []Option{WithStackSize(40)}, object.RecursionMessage},
+		{countdown + "f(20)", []Option{WithStackSize(100)}, 20},
+		{"let f = fn(n) { 1 + f(n + 1) }; try { f(0) } catch (e) { e[\"kind\"] }", nil, "RecursionError"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", nil, object.RecursionMessage},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode(), tt.opts...)
+		err := vm.Run()
+		if thrown, ok := err.(*object.Error); ok {
+			if thrown.Message != tt.expected {
+				t.Errorf("wrong VM error for %q. want=%v, got=%q", tt.input, tt.expected, thrown.Message)
+			}
+			if len(thrown.Stack) > object.MaxStackFrames {
+				t.Errorf("stack not truncated. got %d frames", len(thrown.Stack))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func Test_RecursionErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the innermost frame, at the call that went too deep
+	}{
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", "f 1:22"},
+		{"let f = fn(n) { [1, 2, 3, 4, 5, f(n + 1)] }; f(0)", "f 1:34"},
+		{"let f = fn(n) { let m = n + 1; {m: f(m)} }; f(0)", "f 1:37"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		thrown, ok := err.(*object.Error)
+		if !ok || thrown.Message != object.RecursionMessage {
+			t.Fatalf("expected a recursion error for %q, got %v", tt.input, err)
+		}
+		innermost := thrown.Trace()[0]
+		if got := fmt.Sprintf("%s %s", innermost.Function, innermost.Pos); got != tt.expected {
+			t.Errorf("wrong innermost frame for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func Test_TailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(n) { if (n == 0) { \"done\" } else { f(n - 1) } }; f(1000)", "done"},
+		{"let f = fn(n) { if (n > 0) { return f(n - 1) }; n }; f(1000)", 0},
+		{"let f = fn(n) { match (n) { 0 => \"done\", _ => f(n - 1) } }; f(1000)", "done"},
+		{"let ping = fn(n, other) { if (n == 0) { \"ping\" } else { other(n - 1, ping) } }; let pong = fn(n, other) { if (n == 0) { \"pong\" } else { other(n - 1, pong) } }; ping(1001, pong)", "pong"},
+		{"let sum = fn(arr, acc) { if (len(arr) == 0) { acc } else { sum(rest(arr), acc + first(arr)) } }; sum([1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12], 0)", 78},
+		{"let f = fn(a) { len(a) }; f([1, 2])", 2},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode(), WithMaxFrames(10), WithStackSize(64))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func Test_StepLimit(t *testing.T) {
+	loop := "let f = fn() { f() };"
+	tests := []vmTestCase{
+		{"1 + 2", 3},
+		{loop + "f()", "step limit of 100 exceeded"},
+		{loop + "try { f() } catch (e) { 1 }", "step limit of 100 exceeded"},
+		{loop + "fn() { try { f() } finally { return 1 } }()", "step limit of 100 exceeded"},
+		{loop + "f(); 1", "step limit of 100 exceeded"},
+		{loop + "let r = try { f() } catch (e) { 0 }; r", "step limit of 100 exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode(), WithStepLimit(100))
+		err := vm.Run()
+		if expected, ok := tt.expected.(string); ok {
+			limit, ok := err.(*object.LimitError)
+			if !ok {
+				t.Errorf("no limit error returned for %q. got %T (%+v)", tt.input, err, err)
+				continue
+			}
+			if limit.Message != expected {
+				t.Errorf("wrong message for %q. want=%q, got=%q", tt.input, expected, limit.Message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func Test_RunContext(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("let f = fn() { f() }; f()")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := New(comp.Bytecode()).RunContext(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a limit error for context.Canceled, got %T (%+v)", err, err)
+	}
+
+	if err := New(comp.Bytecode(), WithTimeout(10*time.Millisecond)).Run(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a limit error for context.DeadlineExceeded, got %T (%+v)", err, err)
+	}
+}
+
+func Test_MemoryLimit(t *testing.T) {
+	grow := "let grow = fn(arr, n) { if (n == 0) { len(arr) } else { grow(push(arr, n), n - 1) } };"
+	// Every array holds the one before it, so they all stay in use
+	keep := "let keep = fn(arr) { keep(push(arr, arr)) };"
+	tests := []struct {
+		input    string
+		limit    int64
+		expected interface{}
+	}{
+		{grow + "grow([], 1000)", 0, 1000},
+		// Only the last array is in use, the ones before it are garbage
+		{grow + "grow([], 1000)", 100000, 1000},
+		{keep + "keep([1])", 100000, "memory limit of 100000 bytes exceeded"},
+		{keep + "try { keep([1]) } catch (e) { 0 }", 100000, "memory limit of 100000 bytes exceeded"},
+		{keep + "keep([1]); 1", 100000, "memory limit of 100000 bytes exceeded"},
+		{keep + "let r = try { keep([1]) } catch (e) { 0 }; r", 100000, "memory limit of 100000 bytes exceeded"},
+		{"let s = fn(str, n) { if (n == 0) { str } else { s(str + str, n - 1) } }; len(s(\"ab\", 30))", 1 << 20, "memory limit of 1048576 bytes exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode(), WithMemoryLimit(tt.limit))
+		err := vm.Run()
+		if expected, ok := tt.expected.(string); ok {
+			limit, ok := err.(*object.LimitError)
+			if !ok {
+				t.Errorf("no limit error returned for %q. got %T (%+v)", tt.input, err, err)
+				continue
+			}
+			if limit.Message != expected {
+				t.Errorf("wrong message for %q. want=%q, got=%q", tt.input, expected, limit.Message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func Test_MemoryStats(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`let a = [1, 2, 3]; let s = "ab" + "c"; first([a]); len(s)`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	expected := object.MemoryStats{Allocations: 3, AllocatedBytes: 80 + 27 + 48, PeakBytes: 80 + 27 + 48}
+	if stats := vm.MemoryStats(); stats != expected {
+		t.Errorf("wrong stats. want=%+v, got=%+v", expected, stats)
+	}
+}
+
+func Test_CaseFoldWarnings(t *testing.T) {
+	input := `let check = fn(role) { role == "admin" };
+check("Admin");
+check("ADMIN");
+check("admin");
+"x" != "X";
+"a" == "b";
+`
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode(), WithCaseFoldWarnings())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := []string{
+		`1:29: "Admin" == "admin" is false, but was true when string equality ignored case; use equal_fold() to keep the old behaviour`,
+		`5:5: "x" != "X" is true, but was false when string equality ignored case; use equal_fold() to keep the old behaviour`,
+	}
+
+	warnings := vm.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("wrong number of warnings. want=%d, got=%d (%v)", len(expected), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.String() != expected[i] {
+			t.Errorf("wrong warning.\nexpected\t%q\nactual\t\t%q", expected[i], w.String())
+		}
+	}
+}
+
+func Test_LogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 && 2", 2},
+		{"1 || 2", 1},
+		{"false || 5", 5},
+		{"false && 5", false},
+		{"true && false || 3", 3},
+		{"1 + 2 && 3 + 4", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func Test_NullAndOptionalChaining(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"null == null", true},
+		{"null != 1", true},
+		{"!null", true},
+		{"null ?? 5", 5},
+		{"1 ?? 5", 1},
+		{"false ?? 5", false},
+		{"null ?? null", Null},
+		{"null ?? null ?? 3", 3},
+		{`let cfg = {"db": {"host": "db1"}}; cfg?.["db"]?.["host"] == "db1"`, true},
+		{`let cfg = {}; cfg?.["db"]?.["host"] ?? 5`, 5},
+		{`let cfg = null; cfg?.["db"]?.["host"] ?? 5`, 5},
+		{`[1, 2]?.[1]`, 2},
+		{"let f = fn(x) { x * 2 }; f?.(2)", 4},
+		{"let f = null; f?.(len([1, 2]))", Null},
+		{"let f = null; f?.(1) ?? 7", 7},
+		{"let g = fn(f) { f?.(1) ?? 0 }; g(fn(x) { x + 1 }) + g(null)", 2},
 	}
 
 	runVmTests(t, tests)
@@ -42,7 +874,7 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 			t.Fatalf("vm error: %s", err)
 		}
 
-		stackElem := vm.StackTop()
+		stackElem := vm.LastPoppedStackElem()
 
 		testExpectedObject(t, tt.expected, stackElem)
 	}
@@ -56,6 +888,54 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err := testIntegerObject(int64(expected), actual); err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case bool:
+		if err := testBooleanObject(bool(expected), actual); err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+	case string:
+		if err := testStringObject(expected, actual); err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElem := range expected {
+			if err := testIntegerObject(int64(expectedElem), array.Elements[i]); err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
+			return
+		}
+		if hash.Len() != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), hash.Len())
+			return
+		}
+		for _, pair := range hash.Pairs() {
+			key, _ := object.HashKeyOf(pair.Key)
+			expectedValue, ok := expected[key]
+			if !ok {
+				t.Errorf("unexpected key in Pairs: %s", pair.Key.Inspect())
+				continue
+			}
+			if err := testIntegerObject(expectedValue, pair.Value); err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
 	}
 }
 
@@ -76,3 +956,30 @@ func testIntegerObject(expected int64, actual object.Object) error {
 
 	return nil
 }
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T  (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value.\n\tgot=%t\n\twant=%t", result.Value, expected)
+	}
+	if result != object.NativeBool(expected) {
+		return fmt.Errorf("object is a new Boolean, not the %t singleton", expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T  (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value.\n\tgot=%q\n\twant=%q", result.Value, expected)
+	}
+
+	return nil
+}